@@ -0,0 +1,178 @@
+package archive
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ManifestFileName 清单文件在归档目录中的文件名
+const ManifestFileName = "manifest.json"
+
+// ErrUnchanged 文章已归档且正文没有变化
+var ErrUnchanged = errors.New("article unchanged since last conversion")
+
+// Entry 一篇已归档文章的记录
+type Entry struct {
+	// Key 文章标识，即 parse.ArticleID.Key()
+	Key   string `json:"key"`
+	URL   string `json:"url"`
+	Title string `json:"title"`
+	// Path 输出文件（markdown或打包文件）的路径。清单中保存为相对于归档目录的路径（用 / 分隔），
+	// 在归档目录之外时保存绝对路径；Get 返回的是解析后的绝对路径，与运行时的工作目录无关
+	Path string `json:"path"`
+	// ContentHash 转换时正文的摘要，即 parse.Article.ContentHash
+	ContentHash string    `json:"content_hash"`
+	ConvertedAt time.Time `json:"converted_at"`
+}
+
+// Manifest 归档目录中的清单，记录已转换的文章，用于增量同步。
+// 每次 Put 都会立即写回文件，进程中途退出后再次运行可以从断点继续。
+type Manifest struct {
+	// dir 归档目录的绝对路径
+	dir     string
+	path    string
+	mu      sync.Mutex
+	entries map[string]Entry
+}
+
+type manifestFile struct {
+	Entries []Entry `json:"entries"`
+}
+
+// OpenManifest 打开 dir 目录下的清单，不存在时创建一个空的清单
+func OpenManifest(dir string) (*Manifest, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	m := &Manifest{
+		dir:     dir,
+		path:    filepath.Join(dir, ManifestFileName),
+		entries: make(map[string]Entry),
+	}
+	content, err := os.ReadFile(m.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return m, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var mf manifestFile
+	if err := json.Unmarshal(content, &mf); err != nil {
+		return nil, err
+	}
+	for _, e := range mf.Entries {
+		m.entries[e.Key] = e
+	}
+	return m, nil
+}
+
+// Get 查找文章的记录
+func (m *Manifest) Get(key string) (Entry, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.entries[key]
+	if ok {
+		e.Path = m.resolvePath(e.Path)
+	}
+	return e, ok
+}
+
+// relPath 把输出文件的路径（相对于当前工作目录或绝对路径）转为清单中保存的路径
+func (m *Manifest) relPath(path string) (string, error) {
+	if path == "" {
+		return "", nil
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(m.dir, abs)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return filepath.ToSlash(abs), nil
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// resolvePath 把清单中保存的路径解析为绝对路径
+func (m *Manifest) resolvePath(path string) string {
+	if path == "" {
+		return ""
+	}
+	path = filepath.FromSlash(path)
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(m.dir, path)
+}
+
+// Unchanged 文章已归档、正文摘要一致，并且输出文件仍然存在
+func (m *Manifest) Unchanged(key string, contentHash string) bool {
+	if key == "" {
+		return false
+	}
+	e, ok := m.Get(key)
+	if !ok || e.ContentHash != contentHash {
+		return false
+	}
+	_, err := os.Stat(e.Path)
+	return err == nil
+}
+
+// Put 新增或更新文章的记录，并写回清单文件。e.Path 为相对于当前工作目录的路径或绝对路径
+func (m *Manifest) Put(e Entry) error {
+	if e.Key == "" {
+		return errors.New("manifest entry without key")
+	}
+	path, err := m.relPath(e.Path)
+	if err != nil {
+		return err
+	}
+	e.Path = path
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries[e.Key] = e
+	return m.save()
+}
+
+// save 先写临时文件再重命名，避免写到一半时中断导致清单损坏
+func (m *Manifest) save() error {
+	mf := manifestFile{Entries: make([]Entry, 0, len(m.entries))}
+	for _, e := range m.entries {
+		mf.Entries = append(mf.Entries, e)
+	}
+	// 按转换时间排序，使清单文件的内容稳定
+	sort.Slice(mf.Entries, func(i, j int) bool {
+		a, b := mf.Entries[i], mf.Entries[j]
+		if !a.ConvertedAt.Equal(b.ConvertedAt) {
+			return a.ConvertedAt.Before(b.ConvertedAt)
+		}
+		return a.Key < b.Key
+	})
+	content, err := json.MarshalIndent(mf, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(m.path), ManifestFileName+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), m.path)
+}
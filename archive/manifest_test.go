@@ -0,0 +1,138 @@
+package archive
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// chdir 切换工作目录，测试结束后恢复
+func chdir(t *testing.T, dir string) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
+
+func writeFile(t *testing.T, name string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(name, []byte("content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestManifestPutAndReopen(t *testing.T) {
+	root := t.TempDir()
+	chdir(t, root)
+	writeFile(t, filepath.Join("arch", "标题", "标题.md"))
+	outside := filepath.Join(root, "other", "a.md")
+	writeFile(t, outside)
+
+	m, err := OpenManifest("arch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := m.Get("k1"); ok {
+		t.Fatal("empty manifest has entry k1")
+	}
+	convertedAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	// 路径相对于当前工作目录传入
+	if err := m.Put(Entry{Key: "k1", URL: "u1", Title: "标题", Path: filepath.Join("arch", "标题", "标题.md"), ContentHash: "h1", ConvertedAt: convertedAt}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Put(Entry{Key: "k2", Path: outside, ContentHash: "h2", ConvertedAt: convertedAt.Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Put(Entry{Path: "x"}); err == nil {
+		t.Error("Put without key should fail")
+	}
+
+	content, err := os.ReadFile(filepath.Join("arch", ManifestFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(content), `"path": "标题/标题.md"`) {
+		t.Errorf("path inside the archive is not stored relative to it:\n%s", content)
+	}
+	if !strings.Contains(string(content), filepath.ToSlash(outside)) {
+		t.Errorf("path outside the archive is not stored as absolute:\n%s", content)
+	}
+	if strings.Index(string(content), `"k1"`) > strings.Index(string(content), `"k2"`) {
+		t.Errorf("entries are not sorted by conversion time:\n%s", content)
+	}
+
+	// 从其他工作目录重新打开
+	chdir(t, t.TempDir())
+	m, err = OpenManifest(filepath.Join(root, "arch"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, ok := m.Get("k1")
+	if !ok {
+		t.Fatal("entry k1 not found after reopen")
+	}
+	wantPath := filepath.Join(root, "arch", "标题", "标题.md")
+	if e.Title != "标题" || e.URL != "u1" || e.Path != wantPath || !e.ConvertedAt.Equal(convertedAt) {
+		t.Errorf("entry = %+v, want path %s", e, wantPath)
+	}
+	if e, _ := m.Get("k2"); e.Path != outside {
+		t.Errorf("path = %s, want %s", e.Path, outside)
+	}
+}
+
+func TestManifestUnchanged(t *testing.T) {
+	root := t.TempDir()
+	chdir(t, root)
+	writeFile(t, filepath.Join("arch", "a.md"))
+	m, err := OpenManifest("arch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Put(Entry{Key: "k", Path: filepath.Join("arch", "a.md"), ContentHash: "h"}); err != nil {
+		t.Fatal(err)
+	}
+	// 工作目录变化后，输出文件仍能找到
+	chdir(t, t.TempDir())
+	tests := []struct {
+		name string
+		key  string
+		hash string
+		want bool
+	}{
+		{"unchanged", "k", "h", true},
+		{"content changed", "k", "h2", false},
+		{"unknown article", "other", "h", false},
+		{"empty key", "", "", false},
+	}
+	for _, tt := range tests {
+		if got := m.Unchanged(tt.key, tt.hash); got != tt.want {
+			t.Errorf("%s: Unchanged(%q, %q) = %v, want %v", tt.name, tt.key, tt.hash, got, tt.want)
+		}
+	}
+	if err := os.Remove(filepath.Join(root, "arch", "a.md")); err != nil {
+		t.Fatal(err)
+	}
+	if m.Unchanged("k", "h") {
+		t.Error("Unchanged = true after the output file was removed")
+	}
+}
+
+func TestOpenManifestInvalid(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, ManifestFileName), []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenManifest(dir); err == nil {
+		t.Error("want error for a corrupted manifest")
+	}
+}
@@ -0,0 +1,222 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/fengxxc/wechatmp2markdown/archive"
+	"github.com/fengxxc/wechatmp2markdown/format"
+	"github.com/fengxxc/wechatmp2markdown/parse"
+)
+
+func runBatch(ctx context.Context, args []string) int {
+	fs := newFlagSet("batch", "batch <file|-> [--parallel 4] [--out ./] [--image base64] ...")
+	var po parseOptions
+	po.register(fs)
+	var of outputFlags
+	of.register(fs)
+	out := fs.String("out", "./", "保存目录，每篇文章以标题作为子目录保存")
+	outFormat := fs.String("format", "md", "输出格式: md / zip / targz")
+	parallel := fs.Int("parallel", 4, "同时转换的文章数")
+	archiveDir := fs.String("archive", "", "归档目录，记录已转换的文章，再次运行时跳过没有变化的文章（会忽略 --out）")
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return flagExitCode(err)
+	}
+	if len(positional) != 1 || *parallel <= 0 {
+		fs.Usage()
+		return EXIT_USAGE
+	}
+	if !validFormat(*outFormat) {
+		fmt.Fprintf(os.Stderr, "unknown format: %s\n", *outFormat)
+		return EXIT_USAGE
+	}
+	if err := of.options().Path.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "invalid path template: %v\n", err)
+		return EXIT_USAGE
+	}
+	if *out == format.Stdout && *archiveDir == "" {
+		fmt.Fprintln(os.Stderr, "batch can not write to stdout, use a directory for --out")
+		return EXIT_USAGE
+	}
+
+	// 从文件或 stdin 读取url列表
+	var r io.Reader = os.Stdin
+	if positional[0] != "-" {
+		f, err := os.Open(positional[0])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			return EXIT_ERROR
+		}
+		defer f.Close()
+		r = f
+	}
+	urls, err := readURLList(r)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "read url list error: %v\n", err)
+		return EXIT_ERROR
+	}
+	if len(urls) == 0 {
+		fmt.Fprintln(os.Stderr, "no url to convert")
+		return EXIT_USAGE
+	}
+
+	opts := po.options()
+	var manifest *archive.Manifest
+	if *archiveDir != "" {
+		manifest, err = archive.OpenManifest(*archiveDir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "open manifest error: %v\n", err)
+			return EXIT_ERROR
+		}
+		*out = *archiveDir
+		opts.Hooks.BeforeContent = skipUnchanged(manifest)
+	}
+	parser, err := parse.NewParser(opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return EXIT_USAGE
+	}
+	results := make([]convertResult, len(urls))
+	var wg sync.WaitGroup
+	jobs := make(chan int)
+	for i := 0; i < *parallel; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range jobs {
+				results[idx] = convertOne(ctx, parser, urls[idx], *out, *outFormat, of.options(), po.timeout)
+				if manifest != nil && resultStatus(results[idx]) == "OK" {
+					if err := putManifest(manifest, results[idx]); err != nil {
+						fmt.Fprintf(os.Stderr, "update manifest error: %v\n", err)
+					}
+				}
+				fmt.Fprintf(os.Stderr, "[%d/%d] %s\n", idx+1, len(urls), resultStatus(results[idx]))
+			}
+		}()
+	}
+	for idx := range urls {
+		if ctx.Err() != nil {
+			results[idx] = convertResult{url: urls[idx], err: ctx.Err()}
+			continue
+		}
+		jobs <- idx
+	}
+	close(jobs)
+	wg.Wait()
+
+	return printSummary(os.Stdout, results)
+}
+
+// readURLList 每行一个url，忽略空行和以 # 开头的注释
+func readURLList(r io.Reader) ([]string, error) {
+	var urls []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		urls = append(urls, line)
+	}
+	return urls, scanner.Err()
+}
+
+// manifestKey 清单中文章的key，无法识别文章标识时退化为url
+func manifestKey(article parse.Article) string {
+	if key := article.ID.Key(); key != "" {
+		return key
+	}
+	return "url:" + article.URL
+}
+
+// skipUnchanged 返回 Hooks.BeforeContent，正文没有变化的文章在下载图片前跳过
+func skipUnchanged(manifest *archive.Manifest) func(ctx context.Context, article *parse.Article) error {
+	return func(ctx context.Context, article *parse.Article) error {
+		if manifest.Unchanged(manifestKey(*article), article.ContentHash) {
+			return archive.ErrUnchanged
+		}
+		return nil
+	}
+}
+
+// putManifest 转换成功后写入清单，有图片下载失败的文章不记录，下次运行时会重新转换
+func putManifest(manifest *archive.Manifest, res convertResult) error {
+	title, _ := res.article.Title.Val.(string)
+	return manifest.Put(archive.Entry{
+		Key:         manifestKey(res.article),
+		URL:         res.url,
+		Title:       title,
+		Path:        res.path,
+		ContentHash: res.article.ContentHash,
+		ConvertedAt: time.Now(),
+	})
+}
+
+func resultStatus(res convertResult) string {
+	switch {
+	case errors.Is(res.err, archive.ErrUnchanged), errors.Is(res.err, format.ErrOutputSkipped):
+		return "SKIP"
+	case errors.Is(res.err, context.Canceled):
+		return "CANCEL"
+	case res.err != nil:
+		return "FAIL"
+	case len(res.article.FailedImages) > 0:
+		return "INCOMPLETE"
+	}
+	return "OK"
+}
+
+// printSummary 打印汇总表，返回退出码。被 Ctrl-C 中断的文章不算失败，退出码为 EXIT_INTERRUPT
+func printSummary(w io.Writer, results []convertResult) int {
+	var ok, skipped, incomplete, failed, cancelled int
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "#\tSTATUS\tURL\tTITLE / REASON")
+	for i, res := range results {
+		status := resultStatus(res)
+		var detail string
+		switch status {
+		case "SKIP":
+			skipped++
+			detail = "unchanged"
+			if errors.Is(res.err, format.ErrOutputSkipped) {
+				detail = "output file exists"
+			}
+		case "CANCEL":
+			cancelled++
+			detail = "interrupted"
+		case "FAIL":
+			failed++
+			detail = res.err.Error()
+		case "INCOMPLETE":
+			incomplete++
+			title, _ := res.article.Title.Val.(string)
+			detail = fmt.Sprintf("%s (%d images failed)", title, len(res.article.FailedImages))
+		default:
+			ok++
+			detail, _ = res.article.Title.Val.(string)
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", i+1, status, res.url, detail)
+	}
+	tw.Flush()
+	fmt.Fprintf(w, "\ntotal: %d, ok: %d, skipped: %d, incomplete: %d, failed: %d, cancelled: %d\n",
+		len(results), ok, skipped, incomplete, failed, cancelled)
+
+	switch {
+	case cancelled > 0:
+		return EXIT_INTERRUPT
+	case failed > 0:
+		return EXIT_ERROR
+	case incomplete > 0:
+		return EXIT_INCOMPLETE
+	}
+	return EXIT_OK
+}
@@ -0,0 +1,140 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fengxxc/wechatmp2markdown/archive"
+	"github.com/fengxxc/wechatmp2markdown/format"
+	"github.com/fengxxc/wechatmp2markdown/parse"
+)
+
+func TestPrintSummary(t *testing.T) {
+	ok := convertResult{url: "ok", article: parse.Article{Title: parse.Piece{Type: parse.HEADER, Val: "标题"}}}
+	incomplete := convertResult{url: "incomplete", article: parse.Article{FailedImages: []parse.ImageError{{URL: "img"}}}}
+	failed := convertResult{url: "failed", err: errors.New("parse article error: boom")}
+	skipped := convertResult{url: "skipped", err: fmt.Errorf("save article error: %w", format.ErrOutputSkipped)}
+	unchanged := convertResult{url: "unchanged", err: fmt.Errorf("parse article error: %w", archive.ErrUnchanged)}
+	cancelled := convertResult{url: "cancelled", err: fmt.Errorf("parse article error: %w", context.Canceled)}
+	tests := []struct {
+		name     string
+		results  []convertResult
+		want     int
+		wantLine string
+	}{
+		{"all ok", []convertResult{ok, skipped, unchanged}, EXIT_OK, "total: 3, ok: 1, skipped: 2, incomplete: 0, failed: 0, cancelled: 0"},
+		{"incomplete", []convertResult{ok, incomplete}, EXIT_INCOMPLETE, "incomplete: 1"},
+		{"failed", []convertResult{ok, incomplete, failed}, EXIT_ERROR, "failed: 1"},
+		{"interrupted", []convertResult{failed, cancelled, cancelled}, EXIT_INTERRUPT, "failed: 1, cancelled: 2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sb strings.Builder
+			if got := printSummary(&sb, tt.results); got != tt.want {
+				t.Errorf("exit code = %d, want %d", got, tt.want)
+			}
+			if !strings.Contains(sb.String(), tt.wantLine) {
+				t.Errorf("summary %q does not contain %q", sb.String(), tt.wantLine)
+			}
+			for _, line := range strings.Split(sb.String(), "\n") {
+				if strings.Contains(line, " cancelled ") && !strings.Contains(line, "CANCEL") {
+					t.Errorf("cancelled job listed as %q", line)
+				}
+			}
+		})
+	}
+}
+
+func TestResultStatus(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{nil, "OK"},
+		{errors.New("x"), "FAIL"},
+		{fmt.Errorf("save: %w", format.ErrOutputSkipped), "SKIP"},
+		{archive.ErrUnchanged, "SKIP"},
+		{fmt.Errorf("parse: %w", context.Canceled), "CANCEL"},
+		{fmt.Errorf("parse: %w", context.DeadlineExceeded), "FAIL"},
+	}
+	for _, tt := range tests {
+		if got := resultStatus(convertResult{err: tt.err}); got != tt.want {
+			t.Errorf("resultStatus(%v) = %s, want %s", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestManifestHook(t *testing.T) {
+	root := t.TempDir()
+	manifest, err := archive.OpenManifest(filepath.Join(root, "arch"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	const pageURL = "https://mp.weixin.qq.com/s?__biz=Qml6&mid=100&idx=1&sn=abc"
+	page := `<html><body><div id="img-content"><h1 id="activity-name">标题</h1><div id="js_content">
+<p>正文</p><p><img data-src="https://mmbiz.qpic.cn/mmbiz_png/a/640"></p></div></div></body></html>`
+	var imageRequests int
+	fetcher := parse.FetcherFunc(func(ctx context.Context, req *parse.FetchRequest) (*parse.FetchResponse, error) {
+		if req.Kind == parse.RESOURCE_IMAGE {
+			imageRequests++
+			return &parse.FetchResponse{URL: req.URL, Body: []byte("image")}, nil
+		}
+		return &parse.FetchResponse{URL: req.URL, Body: []byte(page)}, nil
+	})
+	parser, err := parse.NewParser(parse.Options{
+		ImagePolicy: parse.IMAGE_POLICY_BASE64,
+		Fetcher:     fetcher,
+		Hooks:       parse.Hooks{BeforeContent: skipUnchanged(manifest)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 第一次转换：不在清单中
+	res := convertOne(context.Background(), parser, pageURL, filepath.Join(root, "arch"), "md", format.Options{}, 0)
+	if resultStatus(res) != "OK" || imageRequests != 1 {
+		t.Fatalf("first run: status = %s, err = %v, image requests = %d", resultStatus(res), res.err, imageRequests)
+	}
+	if err := putManifest(manifest, res); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := manifest.Get("Qml6/100/1/abc"); !ok {
+		t.Fatal("article not recorded in manifest")
+	}
+
+	// 第二次转换：正文没有变化，下载图片前跳过
+	res = convertOne(context.Background(), parser, pageURL, filepath.Join(root, "arch"), "md", format.Options{}, 0)
+	if !errors.Is(res.err, archive.ErrUnchanged) || resultStatus(res) != "SKIP" || imageRequests != 1 {
+		t.Fatalf("second run: status = %s, err = %v, image requests = %d", resultStatus(res), res.err, imageRequests)
+	}
+
+	// 输出文件被删除后重新转换
+	entry, _ := manifest.Get("Qml6/100/1/abc")
+	if err := os.Remove(entry.Path); err != nil {
+		t.Fatal(err)
+	}
+	res = convertOne(context.Background(), parser, pageURL, filepath.Join(root, "arch"), "md", format.Options{}, 0)
+	if resultStatus(res) != "OK" || imageRequests != 2 {
+		t.Fatalf("third run: status = %s, err = %v, image requests = %d", resultStatus(res), res.err, imageRequests)
+	}
+}
+
+func TestManifestKey(t *testing.T) {
+	tests := []struct {
+		article parse.Article
+		want    string
+	}{
+		{parse.Article{ID: parse.ArticleID{Biz: "b", Mid: "m", Idx: "1", SN: "s"}, URL: "u"}, "b/m/1/s"},
+		{parse.Article{URL: "https://mp.weixin.qq.com/s/short"}, "url:https://mp.weixin.qq.com/s/short"},
+	}
+	for _, tt := range tests {
+		if got := manifestKey(tt.article); got != tt.want {
+			t.Errorf("manifestKey(%+v) = %q, want %q", tt.article.ID, got, tt.want)
+		}
+	}
+}
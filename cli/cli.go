@@ -0,0 +1,267 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/fengxxc/wechatmp2markdown/format"
+	"github.com/fengxxc/wechatmp2markdown/parse"
+	"github.com/fengxxc/wechatmp2markdown/server"
+)
+
+// Version 版本号，编译时通过 -ldflags "-X github.com/fengxxc/wechatmp2markdown/cli.Version=..." 注入
+var Version = "dev"
+
+// 退出码
+const (
+	EXIT_OK         = 0   // 成功
+	EXIT_ERROR      = 1   // 转换失败
+	EXIT_USAGE      = 2   // 命令或参数错误
+	EXIT_INCOMPLETE = 3   // 转换完成，但有图片下载失败
+	EXIT_INTERRUPT  = 130 // 被 Ctrl-C 中断
+)
+
+type command struct {
+	name  string
+	usage string
+	run   func(ctx context.Context, args []string) int
+}
+
+var commands []command
+
+func init() {
+	commands = []command{
+		{"convert", "转换一篇文章", runConvert},
+		{"batch", "从文件或 stdin 读取url列表，批量转换", runBatch},
+		{"server", "启动 web server", runServer},
+		{"inspect", "解析文章并打印标题、meta、图片等信息，不保存", runInspect},
+		{"version", "打印版本号", runVersion},
+	}
+}
+
+// Run 执行命令行，args 不含程序名，返回退出码
+func Run(args []string) int {
+	// Ctrl-C 时取消所有进行中的请求
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	args = legacyArgs(args)
+	if len(args) == 0 {
+		usage(os.Stderr)
+		return EXIT_USAGE
+	}
+	name := args[0]
+	if name == "-h" || name == "--help" || name == "help" {
+		usage(os.Stdout)
+		return EXIT_OK
+	}
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd.run(ctx, args[1:])
+		}
+	}
+	fmt.Fprintf(os.Stderr, "unknown command: %s\n\n", name)
+	usage(os.Stderr)
+	return EXIT_USAGE
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintf(w, "wechatmp2markdown %s 微信公众号文章转Markdown\n\n", Version)
+	fmt.Fprintf(w, "用法: wechatmp2markdown <command> [arguments]\n\n")
+	fmt.Fprintf(w, "command:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "    %-10s %s\n", cmd.name, cmd.usage)
+	}
+	fmt.Fprintf(w, "\n使用 wechatmp2markdown <command> --help 查看命令的参数\n")
+}
+
+// legacyArgs 兼容旧的命令格式：
+//
+//	wechatmp2markdown [url] [filepath] [--image=xxx] [--save=zip]
+//	wechatmp2markdown server [port]
+func legacyArgs(args []string) []string {
+	if len(args) == 0 {
+		return args
+	}
+	if args[0] == "server" && len(args) == 2 && !strings.HasPrefix(args[1], "-") {
+		return []string{"server", "--port", args[1]}
+	}
+	if !strings.HasPrefix(args[0], "http://") && !strings.HasPrefix(args[0], "https://") {
+		return args
+	}
+	res := []string{"convert", args[0]}
+	if len(args) > 1 && !strings.HasPrefix(args[1], "-") {
+		res = append(res, "--out", args[1])
+		args = args[2:]
+	} else {
+		args = args[1:]
+	}
+	for _, arg := range args {
+		switch arg {
+		case "-iu":
+			arg = "--image=url"
+		case "-is":
+			arg = "--image=save"
+		case "-ib":
+			arg = "--image=base64"
+		case "-sz":
+			arg = "--format=zip"
+		case "-st":
+			arg = "--format=targz"
+		}
+		if strings.HasPrefix(arg, "--save=") {
+			arg = "--format=" + arg[len("--save="):]
+		}
+		res = append(res, arg)
+	}
+	return res
+}
+
+// parseFlags 解析参数，允许 flag 出现在位置参数之后，返回位置参数
+func parseFlags(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		if fs.NArg() == 0 {
+			return positional, nil
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
+
+// parseOptions 公共的解析参数
+type parseOptions struct {
+	image          string
+	quality        string
+	proxy          string
+	timeout        time.Duration
+	requestTimeout time.Duration
+	retries        int
+	headings       string
+	headingSize    float64
+	probeHotlink   bool
+}
+
+func (po *parseOptions) register(fs *flag.FlagSet) {
+	fs.StringVar(&po.image, "image", "base64", "图片保存方式: url 引用原地址 / save 保存到本地 / base64 编码到文件内")
+	fs.StringVar(&po.quality, "quality", "original", "图片质量: original 保持原图 / compact 统一转为jpeg")
+	fs.StringVar(&po.proxy, "proxy", "", "代理服务器地址，格式为 ip:port")
+	fs.DurationVar(&po.timeout, "timeout", 0, "单篇文章转换的总超时时间，如 2m，0 为不限制")
+	fs.DurationVar(&po.requestTimeout, "request-timeout", 30*time.Second, "单次请求的超时时间")
+	fs.IntVar(&po.retries, "retries", 2, "请求失败时的重试次数")
+	fs.StringVar(&po.headings, "headings", "auto", "正文中的标题: auto 还根据字号、粗体、居中和编号推断标题 / off 只识别 h1~h6")
+	fs.Float64Var(&po.headingSize, "heading-font-size", 18, "推断标题时，字号（px）不小于该值的独立短行视为标题")
+	fs.BoolVar(&po.probeHotlink, "probe-hotlink", false, "额外请求两张图片，探测防盗链占位图，下载到占位图的图片视为失败")
+}
+
+func (po *parseOptions) options() parse.Options {
+	retries := po.retries
+	if retries == 0 {
+		// RetryPolicy 中 0 表示默认值，-1 才是不重试
+		retries = -1
+	}
+	return parse.Options{
+		ImagePolicy:  parse.ImageArgValue2ImagePolicy(po.image),
+		ImageQuality: parse.ImageArgValue2ImageQuality(po.quality),
+		Proxy:        po.proxy,
+		Timeout:      po.requestTimeout,
+		Retry:        parse.RetryPolicy{MaxRetries: retries},
+		ProbeHotlink: po.probeHotlink,
+		Headings: parse.HeadingOptions{
+			Detection:   parse.HeadingArgValue2HeadingDetection(po.headings),
+			MinFontSize: po.headingSize,
+		},
+	}
+}
+
+// outputFlags 输出格式及保存路径的参数
+type outputFlags struct {
+	frontMatter string
+	flavor      string
+	template    string
+	pinyin      bool
+	ascii       bool
+	maxLength   int
+	portable    bool
+	overwrite   string
+}
+
+func (of *outputFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&of.frontMatter, "front-matter", "none", "在markdown开头输出元数据: none / yaml / toml")
+	fs.StringVar(&of.flavor, "flavor", "extended", "markdown方言，决定删除线、下划线、高亮的写法: extended / gfm / commonmark")
+	fs.StringVar(&of.template, "path-template", "", "相对于 --out 的保存路径模板，如 '{{.Account}}/{{.Date}}-{{.Title}}/index.md'，"+
+		"可用字段: Title Account Date Time Biz Mid SN Index；默认为 '{{.Title}}/{{.Title}}.md'，打包输出时为 '{{.Title}}.md'")
+	fs.BoolVar(&of.pinyin, "slug-pinyin", false, "标题、公众号名中的汉字转为拼音")
+	fs.BoolVar(&of.ascii, "slug-ascii", false, "标题、公众号名中只保留字母、数字和 . _ -")
+	fs.IntVar(&of.maxLength, "slug-max", 0, "标题、公众号名的最大字符数，0 为不限制")
+	fs.StringVar(&of.overwrite, "overwrite", "overwrite", "输出文件已存在时: overwrite 覆盖 / skip 跳过 / rename 加上 -2 等后缀另存 / fail 报错")
+	fs.BoolVar(&of.portable, "portable-names", false, "生成在 windows、macOS 和 linux 上都合法的文件名，而不只是当前系统")
+}
+
+func (of *outputFlags) options() format.Options {
+	return format.Options{
+		FrontMatter: format.FrontMatterArgValue2FrontMatterFormat(of.frontMatter),
+		Flavor:      format.FlavorArgValue2Flavor(of.flavor),
+		Path: format.PathOptions{
+			Template:  of.template,
+			Pinyin:    of.pinyin,
+			ASCII:     of.ascii,
+			MaxLength: of.maxLength,
+			Portable:  of.portable,
+			Overwrite: format.OverwriteArgValue2OverwritePolicy(of.overwrite),
+		},
+	}
+}
+
+// 根据错误类型返回退出码
+func exitCode(err error) int {
+	if errors.Is(err, context.Canceled) {
+		return EXIT_INTERRUPT
+	}
+	return EXIT_ERROR
+}
+
+func newFlagSet(name string, usageLine string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "用法: wechatmp2markdown %s\n\n", usageLine)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// flag 解析失败时的退出码，--help 视为成功
+func flagExitCode(err error) int {
+	if errors.Is(err, flag.ErrHelp) {
+		return EXIT_OK
+	}
+	return EXIT_USAGE
+}
+
+func runServer(ctx context.Context, args []string) int {
+	fs := newFlagSet("server", "server [--port 8964]")
+	port := fs.String("port", "8964", "监听的端口")
+	if _, err := parseFlags(fs, args); err != nil {
+		return flagExitCode(err)
+	}
+	if err := server.Start(":" + *port); err != nil {
+		fmt.Fprintf(os.Stderr, "server error: %v\n", err)
+		return EXIT_ERROR
+	}
+	return EXIT_OK
+}
+
+func runVersion(ctx context.Context, args []string) int {
+	fmt.Printf("wechatmp2markdown %s\n", Version)
+	return EXIT_OK
+}
@@ -0,0 +1,206 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/fengxxc/wechatmp2markdown/format"
+	"github.com/fengxxc/wechatmp2markdown/parse"
+)
+
+func runConvert(ctx context.Context, args []string) int {
+	fs := newFlagSet("convert", "convert <url|file|dir|-> [--out ./] [--image base64] [--format md] ...")
+	var po parseOptions
+	po.register(fs)
+	var of outputFlags
+	of.register(fs)
+	out := fs.String("out", "./", "保存位置：目录则以文章标题作为文件名保存在该目录下；以 .md 结尾则保存为该文件；- 为输出到标准输出")
+	outFormat := fs.String("format", "md", "输出格式: md / zip / targz，zip 和 targz 会把markdown和图片打包成一个文件")
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return flagExitCode(err)
+	}
+	if len(positional) != 1 {
+		fs.Usage()
+		return EXIT_USAGE
+	}
+	if !validFormat(*outFormat) {
+		fmt.Fprintf(os.Stderr, "unknown format: %s\n", *outFormat)
+		return EXIT_USAGE
+	}
+	if err := of.options().Path.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "invalid path template: %v\n", err)
+		return EXIT_USAGE
+	}
+	if err := checkStdout(*out, *outFormat, po); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return EXIT_USAGE
+	}
+
+	sources, err := expandSource(positional[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return EXIT_USAGE
+	}
+	if len(sources) == 0 {
+		fmt.Fprintf(os.Stderr, "no web page file in %s\n", positional[0])
+		return EXIT_USAGE
+	}
+	parser, err := parse.NewParser(po.options())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return EXIT_USAGE
+	}
+	if len(sources) != 1 {
+		// 目录：逐个转换，最后打印汇总表
+		results := make([]convertResult, len(sources))
+		for i, src := range sources {
+			results[i] = convertOne(ctx, parser, src, *out, *outFormat, of.options(), po.timeout)
+		}
+		summary := os.Stdout
+		if *out == format.Stdout {
+			// stdout 只输出markdown
+			summary = os.Stderr
+		}
+		return printSummary(summary, results)
+	}
+
+	src := sources[0]
+	fmt.Fprintf(os.Stderr, "source: %s, out: %s\n", src, *out)
+	res := convertOne(ctx, parser, src, *out, *outFormat, of.options(), po.timeout)
+	if errors.Is(res.err, format.ErrOutputSkipped) {
+		fmt.Fprintf(os.Stderr, "%v\n", errors.Unwrap(res.err))
+		return EXIT_OK
+	}
+	if res.err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", res.err)
+		return exitCode(res.err)
+	}
+	if len(res.article.FailedImages) > 0 {
+		printFailedImages(res.article)
+		return EXIT_INCOMPLETE
+	}
+	return EXIT_OK
+}
+
+// convertResult 一篇文章的转换结果
+type convertResult struct {
+	url     string
+	article parse.Article
+	path    string
+	err     error
+}
+
+// convertOne 解析一篇文章并按 outFormat、opts 保存到 out，timeout 为 0 时不限制时间
+func convertOne(ctx context.Context, parser *parse.Parser, src string, out string, outFormat string, opts format.Options, timeout time.Duration) convertResult {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	res := convertResult{url: src}
+	res.article, res.err = parseSource(ctx, parser, src)
+	if res.err != nil {
+		res.err = fmt.Errorf("parse article error: %w", res.err)
+		return res
+	}
+	if outFormat != "md" {
+		res.path, res.err = format.FormatAndPackTo(res.article, out, format.ArchiveArgValue2ArchiveFormat(outFormat), opts)
+	} else {
+		res.path, res.err = format.FormatAndSaveTo(res.article, out, opts)
+	}
+	if res.err != nil {
+		res.err = fmt.Errorf("save article error: %w", res.err)
+	} else if outFormat != "md" {
+		fmt.Fprintf(os.Stderr, "saved to %s\n", res.path)
+	}
+	return res
+}
+
+// checkStdout 输出到标准输出时只能是单个markdown，图片不能保存为文件
+func checkStdout(out string, outFormat string, po parseOptions) error {
+	if out != format.Stdout {
+		return nil
+	}
+	if outFormat != "md" {
+		return fmt.Errorf("can not write %s to stdout, use --format md", outFormat)
+	}
+	if parse.ImageArgValue2ImagePolicy(po.image) == parse.IMAGE_POLICY_SAVE {
+		return errors.New("can not save images when writing to stdout, use --image url or --image base64")
+	}
+	return nil
+}
+
+func validFormat(outFormat string) bool {
+	switch outFormat {
+	case "md", "zip", "targz", "tar.gz", "tgz":
+		return true
+	}
+	return false
+}
+
+func printFailedImages(article parse.Article) {
+	fmt.Fprintf(os.Stderr, "warning: %d images failed to download, the markdown is incomplete:\n", len(article.FailedImages))
+	for _, imgErr := range article.FailedImages {
+		fmt.Fprintf(os.Stderr, "    %s\n", imgErr.Error())
+	}
+}
+
+func runInspect(ctx context.Context, args []string) int {
+	fs := newFlagSet("inspect", "inspect <url|file|-> [--proxy ip:port]")
+	var po parseOptions
+	po.register(fs)
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return flagExitCode(err)
+	}
+	if len(positional) != 1 {
+		fs.Usage()
+		return EXIT_USAGE
+	}
+	if po.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, po.timeout)
+		defer cancel()
+	}
+	// 只查看信息，不下载图片
+	opts := po.options()
+	opts.ImagePolicy = parse.IMAGE_POLICY_URL
+	parser, err := parse.NewParser(opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return EXIT_USAGE
+	}
+	article, err := parseSource(ctx, parser, positional[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "parse article error: %v\n", err)
+		return exitCode(err)
+	}
+
+	counts := make(map[parse.PieceType]int)
+	countPieces(article.Content, counts)
+	title, _ := article.Title.Val.(string)
+	fmt.Printf("title:   %s\n", title)
+	fmt.Printf("meta:    %s\n", strings.Join(article.Meta, " | "))
+	fmt.Printf("tags:    %s\n", article.Tags)
+	fmt.Printf("pieces:  %d\n", len(article.Content))
+	fmt.Printf("headers: %d\n", counts[parse.HEADER])
+	fmt.Printf("images:  %d\n", counts[parse.IMAGE])
+	fmt.Printf("links:   %d\n", counts[parse.LINK])
+	fmt.Printf("code:    %d\n", counts[parse.CODE_BLOCK])
+	fmt.Printf("tables:  %d\n", counts[parse.TABLE])
+	return EXIT_OK
+}
+
+func countPieces(pieces []parse.Piece, counts map[parse.PieceType]int) {
+	for _, p := range pieces {
+		counts[p.Type]++
+		if children, ok := p.Val.([]parse.Piece); ok {
+			countPieces(children, counts)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package cli
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckStdout(t *testing.T) {
+	tests := []struct {
+		name      string
+		out       string
+		outFormat string
+		image     string
+		wantErr   string
+	}{
+		{"markdown with base64 images", "-", "md", "base64", ""},
+		{"markdown with image urls", "-", "md", "url", ""},
+		{"images saved to files", "-", "md", "save", "can not save images"},
+		{"zip", "-", "zip", "base64", "can not write zip to stdout"},
+		{"tar.gz", "-", "targz", "url", "can not write targz to stdout"},
+		{"directory allows saving images", "./out", "md", "save", ""},
+		{"directory allows zip", "./out", "zip", "save", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkStdout(tt.out, tt.outFormat, parseOptions{image: tt.image})
+			if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("checkStdout = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// captureStdout 把 f 执行期间写入 os.Stdout 的内容写到临时文件中并返回
+func captureStdout(t *testing.T, f func()) string {
+	t.Helper()
+	tmp, err := os.CreateTemp(t.TempDir(), "stdout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tmp.Close()
+	stdout := os.Stdout
+	os.Stdout = tmp
+	defer func() { os.Stdout = stdout }()
+	f()
+	content, err := os.ReadFile(tmp.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
+
+func TestRunConvertStdout(t *testing.T) {
+	dir := t.TempDir()
+	page := `<html><body><div id="img-content"><h1 id="activity-name">管道</h1><div id="js_content">
+<p>正文</p><p><img data-src="https://example.com/a.png"></p></div></div></body></html>`
+	file := filepath.Join(dir, "page.html")
+	if err := os.WriteFile(file, []byte(page), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		args []string
+		want int
+		// wantOut stdout 中的markdown正文，为空时不应有任何输出
+		wantOut string
+	}{
+		{"markdown", []string{"--out", "-", "--image", "url", file}, EXIT_OK, "正文"},
+		{"save images", []string{"--out", "-", "--image", "save", file}, EXIT_USAGE, ""},
+		{"zip", []string{"--out", "-", "--format", "zip", file}, EXIT_USAGE, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var code int
+			out := captureStdout(t, func() { code = runConvert(context.Background(), tt.args) })
+			if code != tt.want {
+				t.Errorf("exit code = %d, want %d", code, tt.want)
+			}
+			if tt.wantOut == "" && out != "" {
+				t.Errorf("stdout = %q, want nothing", out)
+			}
+			if tt.wantOut != "" && (!strings.HasPrefix(out, "# 管道") || !strings.Contains(out, tt.wantOut)) {
+				t.Errorf("stdout = %q, want markdown only", out)
+			}
+			// 不应在当前目录或页面目录中写入文件
+			if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+				t.Errorf("files written: %v", entries)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package cli
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/fengxxc/wechatmp2markdown/parse"
+)
+
+// 输入源：url、本地文件、或 "-" 表示 stdin
+const stdinSource = "-"
+
+func isURL(src string) bool {
+	return strings.HasPrefix(src, "http://") || strings.HasPrefix(src, "https://")
+}
+
+// parseSource 按输入源的类型解析文章
+func parseSource(ctx context.Context, parser *parse.Parser, src string) (parse.Article, error) {
+	switch {
+	case src == stdinSource:
+		return parser.ParseReader(ctx, os.Stdin)
+	case isURL(src):
+		return parser.Parse(ctx, src)
+	}
+	return parser.ParseFile(ctx, src)
+}
+
+// sourceExts 目录中会被转换的文件
+var sourceExts = []string{".html", ".htm", ".mhtml", ".mht", ".warc", ".warc.gz"}
+
+func isSourceFile(name string) bool {
+	name = strings.ToLower(name)
+	for _, ext := range sourceExts {
+		if strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// expandSource 输入源为目录时，展开为目录下的网页文件（不递归，按文件名排序）
+func expandSource(src string) ([]string, error) {
+	if src == stdinSource || isURL(src) {
+		return []string{src}, nil
+	}
+	info, err := os.Stat(src)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{src}, nil
+	}
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, entry := range entries {
+		if !entry.IsDir() && isSourceFile(entry.Name()) {
+			files = append(files, filepath.Join(src, entry.Name()))
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
@@ -0,0 +1,52 @@
+package format
+
+import "github.com/fengxxc/wechatmp2markdown/parse"
+
+// Flavor 目标markdown方言
+type Flavor int32
+
+const (
+	FLAVOR_EXTENDED   Flavor = iota // 删除线 ~~，下划线 <u>，高亮 ==，Typora、Obsidian 等编辑器支持
+	FLAVOR_GFM                      // GitHub Flavored Markdown：删除线 ~~，下划线 <u>，高亮 <mark>
+	FLAVOR_COMMONMARK               // CommonMark：删除线 <del>，下划线 <u>，高亮 <mark>
+)
+
+func FlavorArgValue2Flavor(val string) Flavor {
+	var flavor Flavor
+	switch val {
+	case "gfm":
+		flavor = FLAVOR_GFM
+	case "commonmark":
+		flavor = FLAVOR_COMMONMARK
+	case "extended":
+		fallthrough
+	default:
+		flavor = FLAVOR_EXTENDED
+	}
+	return flavor
+}
+
+// marks 行内样式的开始和结束标记
+func (flavor Flavor) marks(ptype parse.PieceType) (string, string) {
+	switch ptype {
+	case parse.BOLD_TEXT:
+		return "**", "**"
+	case parse.ITALIC_TEXT:
+		return "*", "*"
+	case parse.BOLD_ITALIC_TEXT:
+		return "***", "***"
+	case parse.UNDERLINE_TEXT:
+		return "<u>", "</u>"
+	case parse.STRIKETHROUGH_TEXT:
+		if flavor == FLAVOR_COMMONMARK {
+			return "<del>", "</del>"
+		}
+		return "~~", "~~"
+	case parse.HIGHLIGHT_TEXT:
+		if flavor == FLAVOR_EXTENDED {
+			return "==", "=="
+		}
+		return "<mark>", "</mark>"
+	}
+	return "", ""
+}
@@ -2,11 +2,11 @@ package format
 
 import (
 	"bytes"
-	"encoding/binary"
-	"log"
+	"errors"
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
-	"regexp"
 	"runtime"
 	"strconv"
 	"strings"
@@ -15,9 +15,24 @@ import (
 	"github.com/fengxxc/wechatmp2markdown/util"
 )
 
+// Options 格式化及保存的选项
+type Options struct {
+	// FrontMatter 在markdown开头输出的元数据格式，默认不输出
+	FrontMatter FrontMatterFormat
+	// Flavor 目标markdown方言，决定删除线、下划线、高亮的写法
+	Flavor Flavor
+	// Path 保存路径及同名文件的处理方式
+	Path PathOptions
+}
+
 // Format format article
 func Format(article parse.Article) (string, map[string][]byte) {
-	var result string
+	return FormatWithOptions(article, Options{})
+}
+
+// FormatWithOptions 按 opts 格式化文章
+func FormatWithOptions(article parse.Article, opts Options) (string, map[string][]byte) {
+	var result string = formatFrontMatter(article, opts.FrontMatter)
 	var titleMdStr string = formatTitle(article.Title)
 	result += titleMdStr
 	var metaMdStr string = formatMeta(article.Meta)
@@ -25,58 +40,50 @@ func Format(article parse.Article) (string, map[string][]byte) {
 	var tagsMdStr string = formatTags(article.Tags)
 	result += tagsMdStr
 	var saveImageBytes map[string][]byte
-	content, saveImageBytes := formatContent(article.Content, 0)
+	content, saveImageBytes := formatContent(article.Content, 0, opts.Flavor)
 	result += content
 	return result, saveImageBytes
 }
 
-// windows下, 文件名包含非法字符时, 用相似的Unicode字符进行替换; 长度超过255个字符时，保留前255个字符
-func legalizationFilenameForWindows(name string) string {
-	// Windows文件名不能包含这些字符
-	invalidChars := regexp.MustCompile(`[\\/:*?\"<>|]`)
+// Stdout 作为保存路径时表示输出到标准输出
+const Stdout = "-"
 
-	// 如果包含非法字符,则替换
-	if invalidChars.MatchString(name) {
-		name = strings.ReplaceAll(name, "<", "≺")
-		name = strings.ReplaceAll(name, ">", "≻")
-		name = strings.ReplaceAll(name, ":", "∶")
-		name = strings.ReplaceAll(name, "\"", "“")
-		name = strings.ReplaceAll(name, "/", "∕")
-		name = strings.ReplaceAll(name, "\\", "∖")
-		name = strings.ReplaceAll(name, "|", "∣")
-		name = strings.ReplaceAll(name, "?", "?")
-		name = strings.ReplaceAll(name, "*", "⁎")
-	}
+// ErrImagesNotWritable 图片保存方式为 save 时，图片无法与markdown一起写入单个流
+var ErrImagesNotWritable = errors.New("article has image files to save, use url or base64 image policy instead")
 
-	// 文件名最大长度255字符
-	if len(name) > 255 {
-		// 超出就截断文件名
-		name = name[:255]
+// FormatAndWrite 把markdown写入 w，图片只能是url引用或base64编码的
+func FormatAndWrite(article parse.Article, w io.Writer, opts Options) error {
+	result, saveImageBytes := FormatWithOptions(article, opts)
+	if len(saveImageBytes) > 0 {
+		return ErrImagesNotWritable
 	}
-
-	return name
+	_, err := io.WriteString(w, result)
+	return err
 }
 
-// linux下, 文件名包含非法字符时, 用相似的Unicode字符进行替换
-func legalizationFilenameForLinux(name string) string {
-	// Linux文件名不能包含这些字符
-	invalidChars := regexp.MustCompile(`[\/]`)
-
-	// 如果包含非法字符,则替换
-	if invalidChars.MatchString(name) {
-		name = strings.ReplaceAll(name, "/", "∕")
-	}
+// FormatAndSave fomat article and save to local file, filePath 为 "-" 时输出到标准输出
+func FormatAndSave(article parse.Article, filePath string) error {
+	_, err := FormatAndSaveFile(article, filePath)
+	return err
+}
 
-	return name
+// FormatAndSaveFile 同 FormatAndSave，返回保存的markdown文件路径
+func FormatAndSaveFile(article parse.Article, filePath string) (string, error) {
+	return FormatAndSaveTo(article, filePath, Options{})
 }
 
-// FormatAndSave fomat article and save to local file
-func FormatAndSave(article parse.Article, filePath string) error {
+// FormatAndSaveTo 按 opts 格式化文章并保存，filePath 为目录时按 opts.Path 的模板决定保存路径，
+// 以 .md 结尾时直接保存为该文件；图片保存在markdown所在的目录下。
+// 文件已存在时按 opts.Path.Overwrite 处理，返回实际保存的markdown文件路径
+func FormatAndSaveTo(article parse.Article, filePath string, opts Options) (string, error) {
+	if filePath == Stdout {
+		return Stdout, FormatAndWrite(article, os.Stdout, opts)
+	}
+	pathOpts := opts.Path
 	// basrPath := filepath.Join(filePath, )
 	var basePath string
 	var fileName string
 	var isWin bool = runtime.GOOS == "windows"
-	var isLinux bool = runtime.GOOS == "linux"
 	var separator string
 	if isWin {
 		separator = "\\"
@@ -91,51 +98,137 @@ func FormatAndSave(article parse.Article, filePath string) error {
 		filePath = strings.Replace(filePath, ".", wd, 1)
 	}
 	if strings.HasSuffix(filePath, ".md") {
-		// basePath = filePath[:len(filePath)-len(".md")]
-		basePath = filePath[:strings.LastIndex(filePath, separator)]
+		// 只有文件名时保存到当前目录
+		basePath = filepath.Dir(filePath)
 		fileName = filePath
 	} else {
-		title := strings.TrimSpace(article.Title.Val.(string))
-		if isWin {
-			title = legalizationFilenameForWindows(title)
-		} else if isLinux {
-			title = legalizationFilenameForLinux(title)
+		if strings.TrimSpace(articleTitle(article)) == "" {
+			return "", errors.New("article title is empty")
 		}
-		// title := "thisistitle"
-		basePath = filepath.Join(filePath, title)
-		fileName = filepath.Join(basePath, title+".md")
+		relPath, err := pathOpts.Resolve(article)
+		if err != nil {
+			return "", err
+		}
+		fileName = filepath.Join(filePath, relPath)
+		basePath = filepath.Dir(fileName)
 	}
 
 	// make basePath dir if not exists
 	if _, err := os.Stat(basePath); err != nil {
 		if err := os.MkdirAll(basePath, 0755); err != nil {
-			panic(err)
+			return "", err
 		}
 	}
 
+	if err := pathOpts.Overwrite.checkExists(fileName); err != nil {
+		return fileName, err
+	}
+
 	var saveImageBytes map[string][]byte
-	result, saveImageBytes := Format(article)
+	result, saveImageBytes := FormatWithOptions(article, opts)
 	if len(saveImageBytes) > 0 {
 		for imgTitle := range saveImageBytes {
 			// save to local
-			imgfileName := filepath.Join(basePath, imgTitle)
-			/* if err := ioutil.WriteFile(imgfileName, saveImageBytes[imgTitle], 0644); err != nil {
-				log.Fatalf("can not save image file: %s\n err: %v", imgfileName, err)
-				continue
-			} */
-			f, err := os.Create(imgfileName)
-			if err != nil {
-				// log.Fatalf("can not save image file: %s", imgTitle)
-				log.Fatalf("can not save image file: %s\n err: %v", imgfileName, err)
-				continue
+			imgfileName := filepath.Join(basePath, util.SafeFilename(imgTitle))
+			if err := util.WriteFileAtomic(imgfileName, saveImageBytes[imgTitle], 0644); err != nil {
+				return "", fmt.Errorf("can not save image file: %s err: %w", imgfileName, err)
 			}
-			defer f.Close()
-			buf := new(bytes.Buffer)
-			binary.Write(buf, binary.LittleEndian, saveImageBytes[imgTitle])
-			f.Write(buf.Bytes())
 		}
 	}
-	return os.WriteFile(fileName, []byte(result), 0644)
+	// 图片全部写入后再写markdown，markdown存在即表示转换是完整的
+	return pathOpts.Overwrite.writeFile(fileName, []byte(result))
+}
+
+// ArchiveFormat 打包输出的格式
+type ArchiveFormat int32
+
+const (
+	ARCHIVE_ZIP ArchiveFormat = iota
+	ARCHIVE_TAR_GZ
+)
+
+func ArchiveArgValue2ArchiveFormat(val string) ArchiveFormat {
+	var archiveFormat ArchiveFormat
+	switch val {
+	case "targz", "tar.gz", "tgz":
+		archiveFormat = ARCHIVE_TAR_GZ
+	case "zip":
+		fallthrough
+	default:
+		archiveFormat = ARCHIVE_ZIP
+	}
+	return archiveFormat
+}
+
+// Ext 打包文件的扩展名
+func (af ArchiveFormat) Ext() string {
+	if af == ARCHIVE_TAR_GZ {
+		return ".tar.gz"
+	}
+	return ".zip"
+}
+
+// FormatArchiveFiles 格式化文章，返回打包用的文件：<title>.md 和图片放在包的根目录下
+func FormatArchiveFiles(article parse.Article) (string, map[string][]byte) {
+	return FormatArchiveFilesWithOptions(article, Options{})
+}
+
+// FormatArchiveFilesWithOptions 同 FormatArchiveFiles，按 opts 格式化
+func FormatArchiveFilesWithOptions(article parse.Article, opts Options) (string, map[string][]byte) {
+	// 打包文件可能在不同的系统间传递，使用所有系统都合法的文件名
+	title := util.SanitizeFilename(strings.TrimSpace(articleTitle(article)), util.PortableOS)
+	return title, archiveFiles(article, title+".md", opts)
+}
+
+func archiveFiles(article parse.Article, mdName string, opts Options) map[string][]byte {
+	mdString, files := FormatWithOptions(article, opts)
+	files[mdName] = []byte(mdString)
+	return files
+}
+
+// FormatAndPack 格式化文章，连同图片打包成一个文件保存到 dir 目录下，返回打包文件的路径
+func FormatAndPack(article parse.Article, dir string, archiveFormat ArchiveFormat) (string, error) {
+	return FormatAndPackTo(article, dir, archiveFormat, Options{})
+}
+
+// FormatAndPackTo 同 FormatAndPack，按 opts 格式化，打包文件的路径由 opts.Path 的模板决定（.md 替换为打包格式的扩展名），
+// 默认模板为 DefaultPackTemplate；文件已存在时按 opts.Path.Overwrite 处理
+func FormatAndPackTo(article parse.Article, dir string, archiveFormat ArchiveFormat, opts Options) (string, error) {
+	pathOpts := opts.Path
+	if strings.TrimSpace(articleTitle(article)) == "" {
+		return "", errors.New("article title is empty")
+	}
+	if dir == "" {
+		dir = "."
+	}
+	relPath, err := pathOpts.resolve(article, DefaultPackTemplate)
+	if err != nil {
+		return "", err
+	}
+	fileName := filepath.Join(dir, strings.TrimSuffix(relPath, ".md")+archiveFormat.Ext())
+	if err := os.MkdirAll(filepath.Dir(fileName), 0755); err != nil {
+		return "", err
+	}
+	if err := pathOpts.Overwrite.checkExists(fileName); err != nil {
+		return fileName, err
+	}
+	files := archiveFiles(article, filepath.Base(relPath), opts)
+	var buf bytes.Buffer
+	if archiveFormat == ARCHIVE_TAR_GZ {
+		err = util.WriteTarGz(&buf, files)
+	} else {
+		err = util.WriteZip(&buf, files)
+	}
+	if err != nil {
+		return "", err
+	}
+	return pathOpts.Overwrite.writeFile(fileName, buf.Bytes())
+}
+
+// 文章标题，解析失败时 Title.Val 为 nil
+func articleTitle(article parse.Article) string {
+	title, _ := article.Title.Val.(string)
+	return title
 }
 
 func formatTitle(piece parse.Piece) string {
@@ -144,7 +237,8 @@ func formatTitle(piece parse.Piece) string {
 	for i := 0; i < level; i++ {
 		prefix += "#"
 	}
-	return prefix + " " + piece.Val.(string) + "  \n"
+	text, _ := piece.Val.(string)
+	return prefix + " " + text + "  \n"
 }
 
 func formatMeta(meta []string) string {
@@ -155,7 +249,7 @@ func formatTags(tags string) string {
 	return tags + "  \n" // TODO
 }
 
-func formatContent(pieces []parse.Piece, depth int) (string, map[string][]byte) {
+func formatContent(pieces []parse.Piece, depth int, flavor Flavor) (string, map[string][]byte) {
 	var contentMdStr string
 	var base64Imgs []string
 	var saveImageBytes map[string][]byte = make(map[string][]byte)
@@ -166,43 +260,41 @@ func formatContent(pieces []parse.Piece, depth int) (string, map[string][]byte)
 		case parse.HEADER:
 			pieceMdStr = formatTitle(piece)
 		case parse.LINK:
-			pieceMdStr = formatLink(piece)
+			pieceMdStr, patchSaveImageBytes = formatLink(piece, flavor)
 		case parse.NORMAL_TEXT:
 			pieceMdStr = piece.Val.(string)
-		case parse.BOLD_TEXT:
-			pieceMdStr = "**" + piece.Val.(string) + "**"
-		case parse.ITALIC_TEXT:
-			pieceMdStr = "*" + piece.Val.(string) + "*"
-		case parse.BOLD_ITALIC_TEXT:
-			pieceMdStr = "***" + piece.Val.(string) + "***"
+		case parse.BOLD_TEXT, parse.ITALIC_TEXT, parse.BOLD_ITALIC_TEXT,
+			parse.STRIKETHROUGH_TEXT, parse.UNDERLINE_TEXT, parse.HIGHLIGHT_TEXT:
+			pieceMdStr, patchSaveImageBytes = formatEmphasis(piece, flavor)
 		case parse.IMAGE:
 			if piece.Val == nil {
 				pieceMdStr = formatImageInline(piece)
 			} else {
 				// will save to local
-				src := piece.Attrs["src"]
-				imgExt := util.ParseImageExtFromSrc(src)
-				var hashName string = util.MD5(piece.Val.([]byte)) + "." + imgExt
-				saveImageBytes[hashName] = piece.Val.([]byte)
-				pieceMdStr = formatImageFileReferInline(piece.Attrs["alt"], hashName)
+				pieceMdStr = formatImageFileReferInline(piece.Attrs["alt"], saveImage(piece, saveImageBytes))
 			}
 		case parse.IMAGE_BASE64:
+			if !hasBase64(piece) {
+				pieceMdStr = formatImageInline(piece)
+				break
+			}
 			pieceMdStr = formatImageRefer(piece, len(base64Imgs))
-			base64Imgs = append(base64Imgs, piece.Val.(string))
+			base64Imgs = append(base64Imgs, "data:"+imageMIME(piece)+";base64,"+piece.Val.(string))
 		case parse.TABLE:
 			pieceMdStr = formatTable(piece)
 		case parse.CODE_INLINE:
-			// TODO
+			pieceMdStr = formatCodeInline(piece.Val.(string))
 		case parse.CODE_BLOCK:
 			pieceMdStr = formatCodeBlock(piece)
 		case parse.BLOCK_QUOTES:
-			pieceMdStr, patchSaveImageBytes = formatBlockQuote(piece, depth)
+			pieceMdStr, patchSaveImageBytes = formatBlockQuote(piece, depth, flavor)
 		case parse.O_LIST:
-			pieceMdStr, patchSaveImageBytes = formatList(piece, depth)
+			pieceMdStr, patchSaveImageBytes = formatList(piece, depth, flavor)
 		case parse.U_LIST:
-			pieceMdStr, patchSaveImageBytes = formatList(piece, depth)
+			pieceMdStr, patchSaveImageBytes = formatList(piece, depth, flavor)
 		case parse.HR:
-			// TODO
+			// 前面空一行，避免上一行文字被当作 setext 标题
+			pieceMdStr = "\n---\n"
 		case parse.BR:
 			pieceMdStr = "  \n"
 		case parse.NULL:
@@ -212,7 +304,7 @@ func formatContent(pieces []parse.Piece, depth int) (string, map[string][]byte)
 		util.MergeMap(saveImageBytes, patchSaveImageBytes)
 	}
 	for i := 0; i < len(base64Imgs); i++ {
-		contentMdStr += "\n[" + strconv.Itoa(i) + "]:" + "data:image/png;base64," + base64Imgs[i]
+		contentMdStr += "\n[" + strconv.Itoa(i) + "]:" + base64Imgs[i]
 	}
 	return contentMdStr, saveImageBytes
 }
@@ -229,7 +321,7 @@ func formatTable(piece parse.Piece) string {
 	return tableMdStr
 }
 
-func formatBlockQuote(piece parse.Piece, depth int) (string, map[string][]byte) {
+func formatBlockQuote(piece parse.Piece, depth int, flavor Flavor) (string, map[string][]byte) {
 	var bqMdString string
 	var prefix string = ">"
 	for i := 0; i < depth; i++ {
@@ -237,11 +329,11 @@ func formatBlockQuote(piece parse.Piece, depth int) (string, map[string][]byte)
 	}
 	prefix += " "
 	var saveImageBytes map[string][]byte
-	bqMdString, saveImageBytes = formatContent(piece.Val.([]parse.Piece), depth+1)
+	bqMdString, saveImageBytes = formatContent(piece.Val.([]parse.Piece), depth+1, flavor)
 	return prefix + bqMdString + "  \n", saveImageBytes
 }
 
-func formatList(li parse.Piece, depth int) (string, map[string][]byte) {
+func formatList(li parse.Piece, depth int, flavor Flavor) (string, map[string][]byte) {
 	var listMdString string
 	var prefix string
 	for j := 0; j < depth; j++ {
@@ -253,18 +345,51 @@ func formatList(li parse.Piece, depth int) (string, map[string][]byte) {
 		prefix += strconv.Itoa(1) + ". " // 写死成1也大丈夫，markdown会自动累加序号
 	}
 	var saveImageBytes map[string][]byte
-	listMdString, saveImageBytes = formatContent(li.Val.([]parse.Piece), depth+1)
+	listMdString, saveImageBytes = formatContent(li.Val.([]parse.Piece), depth+1, flavor)
 	return prefix + listMdString + "  \n", saveImageBytes
 }
 
+// formatCodeInline 行内代码，反引号比代码中最长的连续反引号多一个；
+// 代码首尾为反引号，或首尾都是空格时，两边各加一个空格（渲染时会被去掉）
+func formatCodeInline(code string) string {
+	code = strings.ReplaceAll(code, "\n", " ")
+	fence := strings.Repeat("`", longestBacktickRun(code)+1)
+	if strings.HasPrefix(code, "`") || strings.HasSuffix(code, "`") ||
+		strings.HasPrefix(code, " ") && strings.HasSuffix(code, " ") && strings.TrimSpace(code) != "" {
+		code = " " + code + " "
+	}
+	return fence + code + fence
+}
+
+// longestBacktickRun 最长的连续反引号的个数
+func longestBacktickRun(code string) int {
+	longest, run := 0, 0
+	for _, r := range code {
+		if r == '`' {
+			run++
+			if run > longest {
+				longest = run
+			}
+		} else {
+			run = 0
+		}
+	}
+	return longest
+}
+
+// formatCodeBlock 代码块，围栏比代码中最长的连续反引号长，info string 为代码的语言
 func formatCodeBlock(piece parse.Piece) string {
 	var codeMdStr string
-	codeMdStr += "```\n"
 	codeRows := piece.Val.([]string)
+	fence := "```"
+	if longest := longestBacktickRun(strings.Join(codeRows, "\n")); longest >= 3 {
+		fence = strings.Repeat("`", longest+1)
+	}
+	codeMdStr += fence + piece.Attrs["lang"] + "\n"
 	for _, row := range codeRows {
 		codeMdStr += row + "\n"
 	}
-	codeMdStr += "```  \n"
+	codeMdStr += fence + "  \n"
 	return codeMdStr
 }
 
@@ -280,7 +405,25 @@ func formatImageFileReferInline(alt string, refName string) string {
 
 // 图片转成base64并插在原地
 func formatImageBase64Inline(piece parse.Piece) string {
-	return "![" + piece.Attrs["alt"] + "](data:image/png;base64," + piece.Val.(string) + ")  \n"
+	if !hasBase64(piece) {
+		return formatImageInline(piece)
+	}
+	return "![" + piece.Attrs["alt"] + "](data:" + imageMIME(piece) + ";base64," + piece.Val.(string) + ")  \n"
+}
+
+// hasBase64 图片下载失败时没有内容，退回使用原本的url，避免输出空的 data: 链接
+func hasBase64(piece parse.Piece) bool {
+	data, _ := piece.Val.(string)
+	return data != ""
+}
+
+// 图片的MIME类型，parse 未识别时根据图片内容和src判断
+func imageMIME(piece parse.Piece) string {
+	if mimeType := piece.Attrs["mime"]; mimeType != "" {
+		return mimeType
+	}
+	content, _ := piece.Val.([]byte)
+	return util.DetectImageType(content, "", piece.Attrs["src"])
 }
 
 // 图片地址为markdown内引用（用于base64）
@@ -288,7 +431,63 @@ func formatImageRefer(piece parse.Piece, index int) string {
 	return "![" + piece.Attrs["alt"] + "][" + strconv.Itoa(index) + "]  \n"
 }
 
-func formatLink(piece parse.Piece) string {
-	var linkMdStr string = "[" + piece.Val.(string) + "](" + piece.Attrs["href"] + ")  \n"
-	return linkMdStr
+func formatLink(piece parse.Piece, flavor Flavor) (string, map[string][]byte) {
+	text, saveImageBytes := formatInline(piece.Val, flavor)
+	var linkMdStr string = "[" + text + "](" + piece.Attrs["href"] + ")"
+	return linkMdStr, saveImageBytes
+}
+
+// formatEmphasis 粗体、斜体、删除线等，标记见 Flavor.marks
+func formatEmphasis(piece parse.Piece, flavor Flavor) (string, map[string][]byte) {
+	text, saveImageBytes := formatInline(piece.Val, flavor)
+	open, close := flavor.marks(piece.Type)
+	return open + text + close, saveImageBytes
+}
+
+// formatInline 粗体、链接等行内元素的内容，Val 为文字，或为包含嵌套行内元素的 []parse.Piece
+func formatInline(val parse.Value, flavor Flavor) (string, map[string][]byte) {
+	children, ok := val.([]parse.Piece)
+	if !ok {
+		text, _ := val.(string)
+		return text, nil
+	}
+	var inlineMdStr string
+	var saveImageBytes map[string][]byte = make(map[string][]byte)
+	for _, child := range children {
+		var childMdStr string
+		var patchSaveImageBytes map[string][]byte
+		switch child.Type {
+		case parse.BOLD_TEXT, parse.ITALIC_TEXT, parse.BOLD_ITALIC_TEXT,
+			parse.STRIKETHROUGH_TEXT, parse.UNDERLINE_TEXT, parse.HIGHLIGHT_TEXT:
+			childMdStr, patchSaveImageBytes = formatEmphasis(child, flavor)
+		case parse.LINK:
+			var text string
+			text, patchSaveImageBytes = formatInline(child.Val, flavor)
+			childMdStr = "[" + text + "](" + child.Attrs["href"] + ")"
+		case parse.CODE_INLINE:
+			childMdStr = formatCodeInline(child.Val.(string))
+		case parse.IMAGE:
+			// 行内的图片不换行
+			if child.Val == nil {
+				childMdStr = strings.TrimSuffix(formatImageInline(child), "  \n")
+			} else {
+				childMdStr = strings.TrimSuffix(formatImageFileReferInline(child.Attrs["alt"], saveImage(child, saveImageBytes)), "  \n")
+			}
+		case parse.IMAGE_BASE64:
+			childMdStr = strings.TrimSuffix(formatImageBase64Inline(child), "  \n")
+		default:
+			childMdStr, _ = child.Val.(string)
+		}
+		inlineMdStr += childMdStr
+		util.MergeMap(saveImageBytes, patchSaveImageBytes)
+	}
+	return inlineMdStr, saveImageBytes
+}
+
+// saveImage 登记要保存到本地的图片，返回图片的文件名
+func saveImage(piece parse.Piece, saveImageBytes map[string][]byte) string {
+	imgExt := util.ImageExtFromMIME(imageMIME(piece))
+	var hashName string = util.MD5(piece.Val.([]byte)) + "." + imgExt
+	saveImageBytes[hashName] = piece.Val.([]byte)
+	return hashName
 }
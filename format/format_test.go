@@ -0,0 +1,61 @@
+package format
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/fengxxc/wechatmp2markdown/parse"
+)
+
+func TestFormatImageBase64(t *testing.T) {
+	const src = "https://mmbiz.qpic.cn/mmbiz_png/a/640?wx_fmt=png"
+	image := func(val interface{}) parse.Piece {
+		return parse.Piece{Type: parse.IMAGE_BASE64, Val: val, Attrs: map[string]string{"src": src, "alt": "图", "mime": "image/png"}}
+	}
+	tests := []struct {
+		name  string
+		piece parse.Piece
+		want  string
+	}{
+		{"downloaded", image("aW1n"), "data:image/png;base64,aW1n"},
+		{"failed", image(""), "](" + src},
+		{"not attached", image(nil), "](" + src},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			article := parse.Article{FailedImages: []parse.ImageError{{URL: src}}}
+			// 独立成段的图片在文末引用，行内的图片插在原地
+			article.Content = []parse.Piece{tt.piece, {Type: parse.LINK, Val: []parse.Piece{tt.piece}, Attrs: map[string]string{"href": "https://example.com"}}}
+			md, _ := Format(article)
+			if strings.Count(md, tt.want) != 2 {
+				t.Errorf("markdown %q should reference %q twice", md, tt.want)
+			}
+			if strings.Contains(md, ";base64,)") || strings.Contains(md, ";base64,\n") {
+				t.Errorf("markdown %q has an empty data link", md)
+			}
+		})
+	}
+}
+
+func TestFormatCodeInline(t *testing.T) {
+	tests := []struct {
+		code string
+		want string
+	}{
+		{"fmt.Println()", "`fmt.Println()`"},
+		{"a`b", "``a`b``"},
+		{"a``b`c", "```a``b`c```"},
+		{"`a", "`` `a ``"},
+		{"a`", "`` a` ``"},
+		{"``", "``` `` ```"},
+		{" a ", "`  a  `"},
+		{" a", "` a`"},
+		{"  ", "`  `"},
+		{"a\nb", "`a b`"},
+	}
+	for _, tt := range tests {
+		if got := formatCodeInline(tt.code); got != tt.want {
+			t.Errorf("formatCodeInline(%q) = %q, want %q", tt.code, got, tt.want)
+		}
+	}
+}
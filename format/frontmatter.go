@@ -0,0 +1,132 @@
+package format
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/fengxxc/wechatmp2markdown/parse"
+)
+
+// FrontMatterFormat markdown开头的元数据（front matter）格式
+type FrontMatterFormat int32
+
+const (
+	FRONT_MATTER_NONE FrontMatterFormat = iota // 不输出
+	FRONT_MATTER_YAML                          // --- 包围的YAML，Hugo、Hexo、Jekyll、Obsidian、Logseq 都支持
+	FRONT_MATTER_TOML                          // +++ 包围的TOML，Hugo 支持
+)
+
+func FrontMatterArgValue2FrontMatterFormat(val string) FrontMatterFormat {
+	var frontMatter FrontMatterFormat
+	switch val {
+	case "yaml":
+		frontMatter = FRONT_MATTER_YAML
+	case "toml":
+		frontMatter = FRONT_MATTER_TOML
+	case "none":
+		fallthrough
+	default:
+		frontMatter = FRONT_MATTER_NONE
+	}
+	return frontMatter
+}
+
+// frontMatterField 一个元数据字段，val 为 string、[]string、int 或 time.Time，空值不输出
+type frontMatterField struct {
+	key string
+	val interface{}
+}
+
+func frontMatterFields(article parse.Article) []frontMatterField {
+	return []frontMatterField{
+		{"title", strings.TrimSpace(articleTitle(article))},
+		{"author", article.Author},
+		{"account", article.Account},
+		{"date", article.PublishTime},
+		{"url", article.URL},
+		{"short_url", article.ShortURL},
+		{"tags", article.TagList},
+		{"cover", article.Cover},
+		{"description", article.Digest},
+		{"word_count", article.WordCount},
+	}
+}
+
+// formatFrontMatter 按 frontMatter 格式输出文章的元数据
+func formatFrontMatter(article parse.Article, frontMatter FrontMatterFormat) string {
+	var delimiter, assign string
+	switch frontMatter {
+	case FRONT_MATTER_YAML:
+		delimiter, assign = "---", ": "
+	case FRONT_MATTER_TOML:
+		delimiter, assign = "+++", " = "
+	default:
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteString(delimiter + "\n")
+	for _, field := range frontMatterFields(article) {
+		var val string
+		switch v := field.val.(type) {
+		case string:
+			if v == "" {
+				continue
+			}
+			val = quoteString(v)
+		case []string:
+			if len(v) == 0 {
+				continue
+			}
+			quoted := make([]string, len(v))
+			for i, s := range v {
+				quoted[i] = quoteString(s)
+			}
+			val = "[" + strings.Join(quoted, ", ") + "]"
+		case int:
+			if v == 0 {
+				continue
+			}
+			val = strconv.Itoa(v)
+		case time.Time:
+			if v.IsZero() {
+				continue
+			}
+			// ISO 8601，YAML和TOML都会解析为时间
+			val = v.Format(time.RFC3339)
+		}
+		sb.WriteString(field.key + assign + val + "\n")
+	}
+	sb.WriteString(delimiter + "\n\n")
+	return sb.String()
+}
+
+// quoteString 双引号字符串，转义方式同时符合YAML和TOML
+func quoteString(s string) string {
+	var sb strings.Builder
+	sb.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			sb.WriteString(`\"`)
+		case '\\':
+			sb.WriteString(`\\`)
+		case '\n':
+			sb.WriteString(`\n`)
+		case '\r':
+			sb.WriteString(`\r`)
+		case '\t':
+			sb.WriteString(`\t`)
+		default:
+			if unicode.IsControl(r) {
+				fmt.Fprintf(&sb, `\u%04X`, r)
+			} else {
+				sb.WriteRune(r)
+			}
+		}
+	}
+	sb.WriteByte('"')
+	return sb.String()
+}
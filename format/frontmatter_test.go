@@ -0,0 +1,115 @@
+package format
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/fengxxc/wechatmp2markdown/parse"
+)
+
+func TestQuoteString(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"标题", `"标题"`},
+		{`他说"你好"`, `"他说\"你好\""`},
+		{"标题: 副标题", `"标题: 副标题"`},
+		{"# 不是注释", `"# 不是注释"`},
+		{"C:\\path\\to", `"C:\\path\\to"`},
+		{"第一行\n第二行\r\n", `"第一行\n第二行\r\n"`},
+		{"a\tb", `"a\tb"`},
+		{"a\x00b\x1fc\x7f", `"a\u0000b\u001Fc\u007F"`},
+		{"- [a] {b}: 'c' & *d", `"- [a] {b}: 'c' & *d"`},
+		{"", `""`},
+	}
+	for _, tt := range tests {
+		got := quoteString(tt.in)
+		if got != tt.want {
+			t.Errorf("quoteString(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+		// YAML 和 TOML 的双引号字符串与Go的转义方式一致，解析后应得到原文
+		if unquoted, err := strconv.Unquote(got); err != nil || unquoted != tt.in {
+			t.Errorf("quoteString(%q) = %s unquotes to %q, %v", tt.in, got, unquoted, err)
+		}
+	}
+}
+
+func TestFormatFrontMatter(t *testing.T) {
+	article := parse.Article{
+		Title:       parse.Piece{Type: parse.HEADER, Val: " 标题: \"引号\" #1\n换行 \\ "},
+		Author:      "作者",
+		PublishTime: time.Date(2023, 5, 6, 7, 8, 9, 0, time.FixedZone("CST", 8*3600)),
+		URL:         "https://mp.weixin.qq.com/s/abc",
+		TagList:     []string{"标签", `带"引号"`},
+		WordCount:   1200,
+	}
+	tests := []struct {
+		name    string
+		article parse.Article
+		format  FrontMatterFormat
+		want    string
+	}{
+		{
+			name:    "yaml",
+			article: article,
+			format:  FRONT_MATTER_YAML,
+			want: "---\n" +
+				"title: \"标题: \\\"引号\\\" #1\\n换行 \\\\\"\n" +
+				"author: \"作者\"\n" +
+				"date: 2023-05-06T07:08:09+08:00\n" +
+				"url: \"https://mp.weixin.qq.com/s/abc\"\n" +
+				"tags: [\"标签\", \"带\\\"引号\\\"\"]\n" +
+				"word_count: 1200\n" +
+				"---\n\n",
+		},
+		{
+			name:    "toml",
+			article: article,
+			format:  FRONT_MATTER_TOML,
+			want: "+++\n" +
+				"title = \"标题: \\\"引号\\\" #1\\n换行 \\\\\"\n" +
+				"author = \"作者\"\n" +
+				"date = 2023-05-06T07:08:09+08:00\n" +
+				"url = \"https://mp.weixin.qq.com/s/abc\"\n" +
+				"tags = [\"标签\", \"带\\\"引号\\\"\"]\n" +
+				"word_count = 1200\n" +
+				"+++\n\n",
+		},
+		{
+			name:    "utc date",
+			article: parse.Article{PublishTime: time.Date(2023, 5, 6, 7, 8, 9, 0, time.UTC)},
+			format:  FRONT_MATTER_YAML,
+			want:    "---\ndate: 2023-05-06T07:08:09Z\n---\n\n",
+		},
+		{
+			name:    "empty fields omitted",
+			article: parse.Article{Title: parse.Piece{Type: parse.HEADER, Val: "  "}, TagList: []string{}},
+			format:  FRONT_MATTER_TOML,
+			want:    "+++\n+++\n\n",
+		},
+		{
+			name:    "none",
+			article: article,
+			format:  FRONT_MATTER_NONE,
+			want:    "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := formatFrontMatter(tt.article, tt.format); got != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFrontMatterArgValue2FrontMatterFormat(t *testing.T) {
+	tests := map[string]FrontMatterFormat{"yaml": FRONT_MATTER_YAML, "toml": FRONT_MATTER_TOML, "none": FRONT_MATTER_NONE, "json": FRONT_MATTER_NONE}
+	for val, want := range tests {
+		if got := FrontMatterArgValue2FrontMatterFormat(val); got != want {
+			t.Errorf("FrontMatterArgValue2FrontMatterFormat(%q) = %d, want %d", val, got, want)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package format
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/fengxxc/wechatmp2markdown/util"
+)
+
+// OverwritePolicy 输出文件已存在时的处理方式
+type OverwritePolicy int32
+
+const (
+	OVERWRITE_POLICY_REPLACE OverwritePolicy = iota // 覆盖已有的文件
+	OVERWRITE_POLICY_SKIP                           // 跳过，返回 ErrOutputSkipped
+	OVERWRITE_POLICY_RENAME                         // 在文件名后加上 -2、-3 等后缀
+	OVERWRITE_POLICY_FAIL                           // 返回 ErrOutputExists
+)
+
+var (
+	// ErrOutputExists 输出文件已存在，OVERWRITE_POLICY_FAIL 时返回
+	ErrOutputExists = errors.New("output file already exists")
+	// ErrOutputSkipped 输出文件已存在而跳过，OVERWRITE_POLICY_SKIP 时返回
+	ErrOutputSkipped = errors.New("output file already exists, skipped")
+)
+
+func OverwriteArgValue2OverwritePolicy(val string) OverwritePolicy {
+	var policy OverwritePolicy
+	switch val {
+	case "skip":
+		policy = OVERWRITE_POLICY_SKIP
+	case "rename":
+		policy = OVERWRITE_POLICY_RENAME
+	case "fail":
+		policy = OVERWRITE_POLICY_FAIL
+	case "overwrite":
+		fallthrough
+	default:
+		policy = OVERWRITE_POLICY_REPLACE
+	}
+	return policy
+}
+
+// checkExists 写入图片等附属文件之前检查输出文件，避免跳过或失败时留下多余的文件
+func (policy OverwritePolicy) checkExists(fileName string) error {
+	if policy != OVERWRITE_POLICY_SKIP && policy != OVERWRITE_POLICY_FAIL {
+		return nil
+	}
+	if _, err := os.Lstat(fileName); err != nil {
+		return nil
+	}
+	return policy.existsError(fileName)
+}
+
+func (policy OverwritePolicy) existsError(fileName string) error {
+	if policy == OVERWRITE_POLICY_SKIP {
+		return fmt.Errorf("%w: %s", ErrOutputSkipped, fileName)
+	}
+	return fmt.Errorf("%w: %s", ErrOutputExists, fileName)
+}
+
+// writeFile 按 policy 原子地写入输出文件，返回实际写入的文件路径
+func (policy OverwritePolicy) writeFile(fileName string, content []byte) (string, error) {
+	if policy == OVERWRITE_POLICY_REPLACE {
+		return fileName, util.WriteFileAtomic(fileName, content, 0644)
+	}
+	err := util.WriteFileExclusive(fileName, content, 0644)
+	if !errors.Is(err, os.ErrExist) {
+		return fileName, err
+	}
+	if policy != OVERWRITE_POLICY_RENAME {
+		return fileName, policy.existsError(fileName)
+	}
+	for i := 2; ; i++ {
+		name := renamedFile(fileName, i)
+		err := util.WriteFileExclusive(name, content, 0644)
+		if !errors.Is(err, os.ErrExist) {
+			return name, err
+		}
+	}
+}
+
+// renamedFile 在文件名后加上 -i 后缀，超过 util.MaxFilenameBytes 时截断原文件名
+func renamedFile(fileName string, i int) string {
+	dir, file := filepath.Split(fileName)
+	base, ext := splitExt(file)
+	suffix := "-" + strconv.Itoa(i) + ext
+	return dir + util.TruncateFilename(base, util.MaxFilenameBytes-len(suffix)) + suffix
+}
+
+// splitExt 拆分文件名和扩展名，.tar.gz 视为一个扩展名
+func splitExt(fileName string) (string, string) {
+	if strings.HasSuffix(fileName, ARCHIVE_TAR_GZ.Ext()) {
+		return strings.TrimSuffix(fileName, ARCHIVE_TAR_GZ.Ext()), ARCHIVE_TAR_GZ.Ext()
+	}
+	ext := filepath.Ext(fileName)
+	return strings.TrimSuffix(fileName, ext), ext
+}
@@ -0,0 +1,111 @@
+package format
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fengxxc/wechatmp2markdown/parse"
+	"github.com/fengxxc/wechatmp2markdown/util"
+)
+
+func TestOverwritePolicyWriteFile(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy OverwritePolicy
+		// wantNames、wantErr 依次写入三次时返回的文件名，及第二、三次返回的错误
+		wantNames []string
+		wantErr   error
+		// wantContent a.md 最终的内容
+		wantContent string
+	}{
+		{"overwrite", OVERWRITE_POLICY_REPLACE, []string{"a.md", "a.md", "a.md"}, nil, "3"},
+		{"skip", OVERWRITE_POLICY_SKIP, []string{"a.md", "a.md", "a.md"}, ErrOutputSkipped, "1"},
+		{"rename", OVERWRITE_POLICY_RENAME, []string{"a.md", "a-2.md", "a-3.md"}, nil, "1"},
+		{"fail", OVERWRITE_POLICY_FAIL, []string{"a.md", "a.md", "a.md"}, ErrOutputExists, "1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			fileName := filepath.Join(dir, "a.md")
+			for i, want := range tt.wantNames {
+				name, err := tt.policy.writeFile(fileName, []byte{byte('1' + i)})
+				if name != filepath.Join(dir, want) {
+					t.Errorf("write %d: name = %s, want %s", i+1, filepath.Base(name), want)
+				}
+				if i == 0 && err != nil || i > 0 && !errors.Is(err, tt.wantErr) {
+					t.Errorf("write %d: err = %v, want %v", i+1, err, tt.wantErr)
+				}
+				if i > 0 && tt.wantErr != nil && tt.policy.checkExists(fileName) == nil {
+					t.Errorf("checkExists(%s) = nil", fileName)
+				}
+			}
+			content, err := os.ReadFile(fileName)
+			if err != nil || string(content) != tt.wantContent {
+				t.Errorf("content = %q, %v, want %q", content, err, tt.wantContent)
+			}
+			entries, _ := os.ReadDir(dir)
+			var names []string
+			for _, entry := range entries {
+				names = append(names, entry.Name())
+			}
+			if tt.policy == OVERWRITE_POLICY_RENAME && len(names) != 3 || tt.policy != OVERWRITE_POLICY_RENAME && len(names) != 1 {
+				t.Errorf("files = %v", names)
+			}
+		})
+	}
+}
+
+func TestRenamedFile(t *testing.T) {
+	long := strings.Repeat("中", 84) + ".md"
+	tests := []struct {
+		name string
+		i    int
+		want string
+	}{
+		{"a.md", 2, "a-2.md"},
+		{filepath.Join("dir", "a.md"), 10, filepath.Join("dir", "a-10.md")},
+		{"a.tar.gz", 3, "a-3.tar.gz"},
+		{"a.zip", 2, "a-2.zip"},
+		{long, 2, strings.Repeat("中", 83) + "-2.md"},
+	}
+	for _, tt := range tests {
+		got := renamedFile(tt.name, tt.i)
+		if got != tt.want {
+			t.Errorf("renamedFile(%q, %d) = %q, want %q", tt.name, tt.i, got, tt.want)
+		}
+		if len(filepath.Base(got)) > util.MaxFilenameBytes {
+			t.Errorf("renamedFile(%q, %d) is %d bytes", tt.name, tt.i, len(filepath.Base(got)))
+		}
+	}
+}
+
+// TestSaveLongTitle 标题很长时，各种处理方式下的文件名都不超过 util.MaxFilenameBytes
+func TestSaveLongTitle(t *testing.T) {
+	article := parse.Article{Title: parse.Piece{Type: parse.HEADER, Val: strings.Repeat("中", 100)}}
+	for _, policy := range []OverwritePolicy{OVERWRITE_POLICY_REPLACE, OVERWRITE_POLICY_SKIP, OVERWRITE_POLICY_RENAME, OVERWRITE_POLICY_FAIL} {
+		dir := t.TempDir()
+		opts := Options{Path: PathOptions{Template: DefaultPackTemplate, Overwrite: policy}}
+		var names []string
+		for i := 0; i < 3; i++ {
+			name, err := FormatAndSaveTo(article, dir, opts)
+			if err != nil && !errors.Is(err, ErrOutputSkipped) && !errors.Is(err, ErrOutputExists) {
+				t.Fatalf("policy %d: %v", policy, err)
+			}
+			names = append(names, filepath.Base(name))
+		}
+		for _, name := range names {
+			if len(name) > util.MaxFilenameBytes || !strings.HasSuffix(name, ".md") {
+				t.Errorf("policy %d: file name %q is %d bytes", policy, name, len(name))
+			}
+		}
+		entries, _ := os.ReadDir(dir)
+		for _, entry := range entries {
+			if strings.HasSuffix(entry.Name(), ".tmp") {
+				t.Errorf("policy %d: temp file %s left", policy, entry.Name())
+			}
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package format
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fengxxc/wechatmp2markdown/parse"
+	"github.com/fengxxc/wechatmp2markdown/util"
+)
+
+// readZip 读出zip中的所有文件
+func readZip(t *testing.T, fileName string) map[string]string {
+	t.Helper()
+	zr, err := zip.OpenReader(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+	files := make(map[string]string)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[f.Name] = string(content)
+	}
+	return files
+}
+
+// readTarGz 读出tar.gz中的所有文件
+func readTarGz(t *testing.T, fileName string) map[string]string {
+	t.Helper()
+	f, err := os.Open(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(zr)
+	files := make(map[string]string)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[hdr.Name] = string(content)
+	}
+	return files
+}
+
+func TestFormatAndPackTo(t *testing.T) {
+	image := []byte("\x89PNG\r\n\x1a\nimage")
+	imageName := util.MD5(image) + ".png"
+	article := parse.Article{
+		Title: parse.Piece{Type: parse.HEADER, Val: "标题: 打包?", Attrs: map[string]string{"level": "1"}},
+		Content: []parse.Piece{
+			{Type: parse.NORMAL_TEXT, Val: "正文"},
+			{Type: parse.IMAGE, Val: image, Attrs: map[string]string{"src": "https://example.com/a.png", "alt": "图"}},
+		},
+	}
+	tests := []struct {
+		format   string
+		wantName string
+		read     func(*testing.T, string) map[string]string
+	}{
+		{"zip", "标题∶ 打包？.zip", readZip},
+		{"targz", "标题∶ 打包？.tar.gz", readTarGz},
+		{"tgz", "标题∶ 打包？.tar.gz", readTarGz},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			dir := t.TempDir()
+			fileName, err := FormatAndPackTo(article, dir, ArchiveArgValue2ArchiveFormat(tt.format), Options{Path: PathOptions{Portable: true}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fileName != filepath.Join(dir, tt.wantName) {
+				t.Errorf("file name = %s, want %s", filepath.Base(fileName), tt.wantName)
+			}
+			files := tt.read(t, fileName)
+			if len(files) != 2 {
+				t.Errorf("files = %v, want markdown and one image", files)
+			}
+			md, ok := files["标题∶ 打包？.md"]
+			if !ok || !strings.Contains(md, "正文") || !strings.Contains(md, "![图]("+imageName+")") {
+				t.Errorf("markdown = %q", md)
+			}
+			if files[imageName] != string(image) {
+				t.Errorf("image %s = %q", imageName, files[imageName])
+			}
+		})
+	}
+}
+
+func TestFormatAndPackToEmptyTitle(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := FormatAndPackTo(parse.Article{}, dir, ARCHIVE_ZIP, Options{}); err == nil {
+		t.Error("want error for an article without title")
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("files written: %v", entries)
+	}
+}
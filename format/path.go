@@ -0,0 +1,187 @@
+package format
+
+import (
+	"errors"
+	"io"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+	"unicode"
+
+	"github.com/fengxxc/wechatmp2markdown/parse"
+	"github.com/fengxxc/wechatmp2markdown/util"
+	"github.com/mozillazg/go-pinyin"
+)
+
+// DefaultPathTemplate 默认的保存路径：<标题>/<标题>.md
+const DefaultPathTemplate = "{{.Title}}/{{.Title}}.md"
+
+// DefaultPackTemplate 打包输出时默认的保存路径，扩展名 .md 会被替换为打包格式的扩展名
+const DefaultPackTemplate = "{{.Title}}.md"
+
+// PathOptions 保存路径的模板、文件名的规范化方式及同名文件的处理方式
+type PathOptions struct {
+	// Template 相对于保存目录的markdown文件路径，text/template 语法，可用的字段见 PathFields，
+	// 用 / 分隔目录，例如 {{.Account}}/{{.Date}}-{{.Title}}/index.md；为空时使用默认模板
+	Template string
+	// Pinyin 把标题、公众号名中的汉字转为拼音
+	Pinyin bool
+	// ASCII 标题、公众号名中只保留字母、数字和 . _ -，其余字符替换为 -
+	ASCII bool
+	// MaxLength 标题、公众号名的最大字符数，0 为不限制
+	MaxLength int
+	// Portable 生成在所有系统上都合法的文件名，而不只是当前系统
+	Portable bool
+	// Overwrite 输出文件已存在时的处理方式，默认覆盖
+	Overwrite OverwritePolicy
+}
+
+// PathFields 路径模板中可用的文章字段
+type PathFields struct {
+	Title   string
+	Account string
+	// Date 发布日期，格式为 2006-01-02
+	Date string
+	// Time 发布时间，可在模板中自定义格式，如 {{.Time.Format "200601"}}
+	Time time.Time
+	Biz  string
+	Mid  string
+	SN   string
+	// Index 文章在当次群发中的位置，从 1 开始
+	Index string
+}
+
+// Fields 按 po 规范化文章的字段，字段中的 / 等非法字符会被替换，只有模板中的 / 才会分隔目录
+func (po PathOptions) Fields(article parse.Article) PathFields {
+	fields := PathFields{
+		Title:   po.sanitize(po.slugify(strings.TrimSpace(articleTitle(article)))),
+		Account: po.sanitize(po.slugify(article.Account)),
+		Time:    article.PublishTime,
+		Biz:     po.sanitize(article.ID.Biz),
+		Mid:     po.sanitize(article.ID.Mid),
+		SN:      po.sanitize(article.ID.SN),
+		Index:   po.sanitize(article.ID.Idx),
+	}
+	if !article.PublishTime.IsZero() {
+		fields.Date = article.PublishTime.Format("2006-01-02")
+	}
+	return fields
+}
+
+// Validate 检查路径模板的语法及使用的字段
+func (po PathOptions) Validate() error {
+	if po.Template == "" {
+		return nil
+	}
+	tmpl, err := template.New("path").Option("missingkey=error").Parse(po.Template)
+	if err != nil {
+		return err
+	}
+	return tmpl.Execute(io.Discard, PathFields{})
+}
+
+// Resolve 执行路径模板，返回相对于保存目录的markdown文件路径
+func (po PathOptions) Resolve(article parse.Article) (string, error) {
+	return po.resolve(article, DefaultPathTemplate)
+}
+
+func (po PathOptions) resolve(article parse.Article, defaultTemplate string) (string, error) {
+	text := po.Template
+	if text == "" {
+		text = defaultTemplate
+	}
+	tmpl, err := template.New("path").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, po.Fields(article)); err != nil {
+		return "", err
+	}
+	// 逐级处理文件名，去掉空的、. 和 .. 的路径，避免写到保存目录之外
+	var segments []string
+	for _, segment := range strings.Split(filepath.ToSlash(sb.String()), "/") {
+		segment = strings.TrimSpace(segment)
+		if segment == "" || segment == "." || segment == ".." {
+			continue
+		}
+		segments = append(segments, segment)
+	}
+	if len(segments) == 0 || segments[len(segments)-1] == ".md" {
+		return "", errors.New("empty file name from path template: " + text)
+	}
+	if !strings.HasSuffix(segments[len(segments)-1], ".md") {
+		segments[len(segments)-1] += ".md"
+	}
+	// 加上扩展名之后再处理，文件名过长时截断标题而保留 .md
+	for i, segment := range segments {
+		segments[i] = po.sanitize(segment)
+	}
+	return filepath.Join(segments...), nil
+}
+
+// sanitize 处理文件名中的非法字符
+func (po PathOptions) sanitize(name string) string {
+	if po.Portable {
+		return util.SanitizeFilename(name, util.PortableOS)
+	}
+	return util.SafeFilename(name)
+}
+
+// slugify 按 po 转换拼音、只保留ASCII字符并截断长度
+func (po PathOptions) slugify(s string) string {
+	if po.Pinyin {
+		s = toPinyin(s)
+	}
+	if po.ASCII {
+		s = toASCII(s)
+	}
+	if po.MaxLength > 0 {
+		if runes := []rune(s); len(runes) > po.MaxLength {
+			s = strings.TrimRight(strings.TrimSpace(string(runes[:po.MaxLength])), "-")
+		}
+	}
+	return s
+}
+
+// toPinyin 把汉字转为拼音，与相邻的字之间用 - 分隔，其它字符保持不变
+func toPinyin(s string) string {
+	args := pinyin.NewArgs()
+	var sb strings.Builder
+	prevHan, prevSep := false, true
+	for _, r := range s {
+		py := pinyin.SinglePinyin(r, args)
+		isHan := len(py) > 0
+		isSep := unicode.IsSpace(r) || r == '-'
+		if (isHan || prevHan) && !prevSep && !isSep {
+			sb.WriteByte('-')
+		}
+		if isHan {
+			sb.WriteString(py[0])
+		} else {
+			sb.WriteRune(r)
+		}
+		prevHan, prevSep = isHan, isSep
+	}
+	return sb.String()
+}
+
+// toASCII 只保留字母、数字和 . _ -，其余连续的字符替换为一个 -
+func toASCII(s string) string {
+	var sb strings.Builder
+	dash := false
+	for _, r := range s {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r) || r == '.' || r == '_') {
+			sb.WriteRune(r)
+			dash = false
+			continue
+		}
+		// 原有的 - 与被替换的字符相邻时也只保留一个
+		if !dash && sb.Len() > 0 {
+			sb.WriteByte('-')
+			dash = true
+		}
+	}
+	return strings.Trim(sb.String(), "-")
+}
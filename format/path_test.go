@@ -0,0 +1,184 @@
+package format
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fengxxc/wechatmp2markdown/parse"
+)
+
+func TestToPinyin(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"你好世界", "ni-hao-shi-jie"},
+		{"Go 语言入门", "Go yu-yan-ru-men"},
+		{"A股", "A-gu"},
+		{"微信-公众号", "wei-xin-gong-zhong-hao"},
+		{"English", "English"},
+	}
+	for _, tt := range tests {
+		if got := toPinyin(tt.in); got != tt.want {
+			t.Errorf("toPinyin(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestToASCII(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"Hello, World!", "Hello-World"},
+		{"v1.2_beta", "v1.2_beta"},
+		{"a -- b", "a-b"},
+		{"di-1-zhang-：-kai-shi", "di-1-zhang-kai-shi"},
+		{"--a/b--", "a-b"},
+		{"中文", ""},
+		{"Ｆｕｌｌ", ""},
+	}
+	for _, tt := range tests {
+		if got := toASCII(tt.in); got != tt.want {
+			t.Errorf("toASCII(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestPathOptionsResolve(t *testing.T) {
+	article := parse.Article{
+		Title:       parse.Piece{Type: parse.HEADER, Val: " Go 语言入门：第1章 "},
+		Account:     "技术/公众号",
+		PublishTime: time.Date(2023, 5, 6, 7, 8, 9, 0, time.UTC),
+		ID:          parse.ArticleID{Biz: "MzA5", Mid: "2650", Idx: "2", SN: "abc"},
+	}
+	tests := []struct {
+		name    string
+		opts    PathOptions
+		article parse.Article
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "default template",
+			want: "Go 语言入门：第1章/Go 语言入门：第1章.md",
+		},
+		{
+			name: "fields",
+			opts: PathOptions{Template: `{{.Account}}/{{.Time.Format "200601"}}/{{.Date}}-{{.Index}}-{{.Title}}`},
+			want: "技术∕公众号/202305/2023-05-06-2-Go 语言入门：第1章.md",
+		},
+		{
+			name: "ids",
+			opts: PathOptions{Template: "{{.Biz}}/{{.Mid}}_{{.Index}}_{{.SN}}.md"},
+			want: "MzA5/2650_2_abc.md",
+		},
+		{
+			name: "pinyin",
+			opts: PathOptions{Template: "{{.Account}}/{{.Title}}.md", Pinyin: true},
+			want: "ji-shu-∕-gong-zhong-hao/Go yu-yan-ru-men-：-di-1-zhang.md",
+		},
+		{
+			// 公众号名没有ASCII字符，目录为空时省略
+			name: "ascii",
+			opts: PathOptions{Template: "{{.Account}}/{{.Title}}.md", ASCII: true},
+			want: "Go-1.md",
+		},
+		{
+			name: "pinyin and ascii",
+			opts: PathOptions{Template: "{{.Account}}/{{.Title}}.md", Pinyin: true, ASCII: true},
+			want: "ji-shu-gong-zhong-hao/Go-yu-yan-ru-men-di-1-zhang.md",
+		},
+		{
+			name: "max length",
+			opts: PathOptions{Template: "{{.Title}}.md", Pinyin: true, ASCII: true, MaxLength: 10},
+			want: "Go-yu-yan.md",
+		},
+		{
+			name:    "current os",
+			opts:    PathOptions{Template: "{{.Title}}.md"},
+			article: parse.Article{Title: parse.Piece{Type: parse.HEADER, Val: "a/b"}},
+			want:    "a∕b.md",
+		},
+		{
+			name:    "portable",
+			opts:    PathOptions{Template: "{{.Title}}.md", Portable: true},
+			article: parse.Article{Title: parse.Piece{Type: parse.HEADER, Val: `a:b?<c>`}},
+			want:    "a∶b？≺c≻.md",
+		},
+		{
+			name:    "field values can not escape the directory",
+			opts:    PathOptions{Template: "{{.Account}}/{{.Title}}.md"},
+			article: parse.Article{Title: parse.Piece{Type: parse.HEADER, Val: "../../etc/passwd"}, Account: ".."},
+			want:    "_/..∕..∕etc∕passwd.md",
+		},
+		{
+			name: "dot segments in template removed",
+			opts: PathOptions{Template: "../.././{{.Title}}//index"},
+			want: "Go 语言入门：第1章/index.md",
+		},
+		{
+			name:    "empty title",
+			opts:    PathOptions{Template: "{{.Account}}/{{.Title}}.md"},
+			article: parse.Article{Title: parse.Piece{Type: parse.HEADER, Val: "  "}, Account: "号"},
+			wantErr: true,
+		},
+		{
+			name:    "empty after slugify",
+			opts:    PathOptions{Template: "{{.Title}}.md", ASCII: true},
+			article: parse.Article{Title: parse.Piece{Type: parse.HEADER, Val: "中文"}},
+			wantErr: true,
+		},
+		{
+			name:    "unknown field",
+			opts:    PathOptions{Template: "{{.Author}}.md"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.article.Title.Val == nil {
+				tt.article = article
+			}
+			got, err := tt.opts.Resolve(tt.article)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Resolve = %q, want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if filepath.ToSlash(got) != tt.want {
+				t.Errorf("Resolve = %q, want %q", filepath.ToSlash(got), tt.want)
+			}
+			for _, segment := range strings.Split(filepath.ToSlash(got), "/") {
+				if segment == ".." || segment == "." || segment == "" {
+					t.Errorf("Resolve = %q has segment %q", got, segment)
+				}
+			}
+		})
+	}
+}
+
+func TestPathOptionsValidate(t *testing.T) {
+	tests := []struct {
+		template string
+		wantErr  bool
+	}{
+		{"", false},
+		{DefaultPathTemplate, false},
+		{`{{.Account}}/{{.Time.Format "2006"}}/{{.Title}}.md`, false},
+		{"{{.Title", true},
+		{"{{.Unknown}}.md", true},
+	}
+	for _, tt := range tests {
+		err := PathOptions{Template: tt.template}.Validate()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Validate(%q) = %v, want error %v", tt.template, err, tt.wantErr)
+		}
+	}
+}
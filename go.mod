@@ -2,7 +2,10 @@ module github.com/fengxxc/wechatmp2markdown
 
 go 1.20
 
-require github.com/PuerkitoBio/goquery v1.8.1
+require (
+	github.com/PuerkitoBio/goquery v1.8.1
+	github.com/mozillazg/go-pinyin v0.20.0
+)
 
 require (
 	github.com/andybalholm/cascadia v1.3.1 // indirect
@@ -0,0 +1,175 @@
+package parse
+
+import (
+	"encoding/json"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// 行号栏，微信的 code-snippet 及常见的代码高亮插件生成的行号
+const lineNumberSelector = ".code-snippet__line-index, .line-numbers-rows, .hljs-ln-numbers, .gutter, .linenodiv"
+
+// codeText 代码的文字，br 转为换行，&nbsp; 转为空格，跳过行号栏
+func codeText(s *goquery.Selection) string {
+	var sb strings.Builder
+	var walk func(sel *goquery.Selection)
+	walk = func(sel *goquery.Selection) {
+		sel.Contents().Each(func(i int, sc *goquery.Selection) {
+			switch {
+			case goquery.NodeName(sc) == "#text":
+				sb.WriteString(strings.ReplaceAll(sc.Text(), "\u00a0", " "))
+			case sc.Is("br"):
+				sb.WriteString("\n")
+			case sc.Is(lineNumberSelector):
+			default:
+				walk(sc)
+			}
+		})
+	}
+	walk(s)
+	return sb.String()
+}
+
+// 每行开头的行号及与代码之间的分隔，如 “1 ”、“ 2.”、“3|”
+var lineNumberReg = regexp.MustCompile(`^\s*(\d+)([.:|]\s?|\s)`)
+
+// stripLineNumbers 所有的行都以从1开始连续的行号及分隔符开头、且行号之后有代码时，去掉行号。
+// 只有数字的行（如内容就是 1 到 n 的代码块）不是行号，保持原样
+func stripLineNumbers(rows []string) []string {
+	if len(rows) < 2 {
+		return rows
+	}
+	stripped := make([]string, len(rows))
+	var hasCode bool
+	for i, row := range rows {
+		m := lineNumberReg.FindStringSubmatch(row)
+		if m == nil || m[1] != strconv.Itoa(i+1) {
+			return rows
+		}
+		stripped[i] = row[len(m[0]):]
+		hasCode = hasCode || strings.TrimSpace(stripped[i]) != ""
+	}
+	if !hasCode {
+		return rows
+	}
+	return stripped
+}
+
+// 不表示语言的 data-lang 值及类名后缀
+var noLanguages = map[string]bool{
+	"":            true,
+	"none":        true,
+	"nohighlight": true,
+	"undefined":   true,
+	"null":        true,
+}
+
+// 语言的别名，转为 markdown 渲染器通用的名称
+var languageAliases = map[string]string{
+	"c++":       "cpp",
+	"c#":        "csharp",
+	"js":        "javascript",
+	"ts":        "typescript",
+	"py":        "python",
+	"golang":    "go",
+	"sh":        "bash",
+	"shell":     "bash",
+	"yml":       "yaml",
+	"plain":     "text",
+	"plaintext": "text",
+}
+
+// codeLanguage 依次从 data-lang 属性、language-xxx / lang-xxx 类名中取得代码的语言，都没有时根据代码内容推断。
+// 微信代码块的 code-snippet__js 等类名与实际的语言无关，不使用
+func codeLanguage(s *goquery.Selection, code string) string {
+	elements := s.Find("*").AddBack()
+	var lang string
+	elements.EachWithBreak(func(i int, sc *goquery.Selection) bool {
+		lang = strings.ToLower(strings.TrimSpace(sc.AttrOr("data-lang", "")))
+		return noLanguages[lang]
+	})
+	for _, prefix := range []string{"language-", "lang-"} {
+		if !noLanguages[lang] {
+			break
+		}
+		elements.EachWithBreak(func(i int, sc *goquery.Selection) bool {
+			for _, class := range strings.Fields(sc.AttrOr("class", "")) {
+				if name, ok := strings.CutPrefix(class, prefix); ok && !noLanguages[strings.ToLower(name)] {
+					lang = strings.ToLower(name)
+					return false
+				}
+			}
+			return true
+		})
+	}
+	if noLanguages[lang] {
+		lang = inferLanguage(code)
+	}
+	if alias, ok := languageAliases[lang]; ok {
+		lang = alias
+	}
+	return lang
+}
+
+// languageRule 根据代码内容推断语言的规则，按顺序匹配
+type languageRule struct {
+	lang string
+	reg  *regexp.Regexp
+}
+
+var languageRules = []languageRule{
+	{"php", regexp.MustCompile(`^\s*<\?php`)},
+	{"html", regexp.MustCompile(`(?i)^\s*<(!doctype|html|head|body|div|template)[\s>]`)},
+	{"xml", regexp.MustCompile(`^\s*<\?xml`)},
+	{"go", regexp.MustCompile(`(?m)^package \w+$|^func (\(\w+ \*?\w+\) )?\w+\(|:= `)},
+	{"rust", regexp.MustCompile(`(?m)^\s*(pub )?fn \w+\(|let mut |println!\(`)},
+	{"cpp", regexp.MustCompile(`#include\s*<(iostream|vector|string|map)>|std::|cout\s*<<`)},
+	{"c", regexp.MustCompile(`(?m)^#include\s*[<"]`)},
+	{"java", regexp.MustCompile(`public (static )?(final )?(class|void|interface) |System\.out\.print`)},
+	{"python", regexp.MustCompile(`(?m)^\s*(def \w+\(.*\)( -> .+)?|class \w+(\(.*\))?|if __name__ == .__main__.):\s*$|^\s*(from [\w.]+ )?import [\w.]+( as \w+)?\s*$`)},
+	{"javascript", regexp.MustCompile(`(?m)^\s*(const|let|var) \w+ = |console\.log\(|^\s*function \w*\(|=> \{|require\(['"]`)},
+	{"sql", regexp.MustCompile(`(?i)^\s*(select\s[\s\S]+?\sfrom\s|insert\s+into\s|update\s+\w+\s+set\s|delete\s+from\s|create\s+(table|index|database|view)\s|alter\s+table\s)`)},
+	{"dockerfile", regexp.MustCompile(`(?m)^FROM \S+(\s+AS \w+)?\s*$[\s\S]*^(RUN|COPY|ADD|CMD|ENTRYPOINT|WORKDIR|ENV) `)},
+	{"bash", regexp.MustCompile(`(?m)^(#!/bin/(ba)?sh|#!/usr/bin/env (ba)?sh)|^\s*\$ |^\s*(sudo|apt(-get)?|yum|brew|npm|pip3?|go|git|docker|kubectl|curl|wget|cd|mkdir|export|chmod) `)},
+}
+
+// 形如 key: value 或 - item 的行
+var yamlLineReg = regexp.MustCompile(`^\s*(- |-$|[\w.-]+:(\s|$)|#)`)
+
+// inferLanguage 根据代码内容推断语言，无法推断时返回空字符串
+func inferLanguage(code string) string {
+	trimmed := strings.TrimSpace(code)
+	if trimmed == "" {
+		return ""
+	}
+	if (strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[")) && json.Valid([]byte(trimmed)) {
+		return "json"
+	}
+	for _, rule := range languageRules {
+		if rule.reg.MatchString(code) {
+			return rule.lang
+		}
+	}
+	if isYAML(trimmed) {
+		return "yaml"
+	}
+	return ""
+}
+
+// isYAML 至少两行、每行都是 key: value、- item 或注释
+func isYAML(code string) bool {
+	lines := 0
+	for _, line := range strings.Split(code, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if !yamlLineReg.MatchString(line) || strings.HasSuffix(strings.TrimSpace(line), ";") {
+			return false
+		}
+		lines++
+	}
+	return lines >= 2
+}
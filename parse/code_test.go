@@ -0,0 +1,110 @@
+package parse
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStripLineNumbers(t *testing.T) {
+	tests := []struct {
+		name string
+		rows []string
+		want []string
+	}{
+		{
+			name: "space separated",
+			rows: []string{"1 package main", "2 ", "3 func main() {}"},
+			want: []string{"package main", "", "func main() {}"},
+		},
+		{
+			name: "dot and pipe separators",
+			rows: []string{" 1. a := 1", " 2| b := 2"},
+			want: []string{"a := 1", "b := 2"},
+		},
+		{
+			name: "bare number line",
+			rows: []string{"1 x = 1", "2", "3 y = 2"},
+			want: []string{"1 x = 1", "2", "3 y = 2"},
+		},
+		{
+			name: "numbers 1 to n are content",
+			rows: []string{"1", "2", "3"},
+			want: []string{"1", "2", "3"},
+		},
+		{
+			name: "numbers with trailing spaces are content",
+			rows: []string{"1 ", "2 ", "3 "},
+			want: []string{"1 ", "2 ", "3 "},
+		},
+		{
+			name: "not starting from 1",
+			rows: []string{"2 a", "3 b"},
+			want: []string{"2 a", "3 b"},
+		},
+		{
+			name: "not sequential",
+			rows: []string{"1 a", "3 b"},
+			want: []string{"1 a", "3 b"},
+		},
+		{
+			name: "one row without number",
+			rows: []string{"1 a", "b", "3 c"},
+			want: []string{"1 a", "b", "3 c"},
+		},
+		{
+			name: "single row is kept",
+			rows: []string{"1 SELECT 1"},
+			want: []string{"1 SELECT 1"},
+		},
+		{
+			name: "numbers in code are not line numbers",
+			rows: []string{"10 PRINT", "20 GOTO 10"},
+			want: []string{"10 PRINT", "20 GOTO 10"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := stripLineNumbers(tt.rows)
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("stripLineNumbers(%q) = %q, want %q", tt.rows, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInferLanguage(t *testing.T) {
+	tests := []struct {
+		code string
+		want string
+	}{
+		{`{"name": "a", "list": [1, 2]}`, "json"},
+		{`[1, 2, 3]`, "json"},
+		{"<?php\necho 'hi';", "php"},
+		{"<!DOCTYPE html>\n<html></html>", "html"},
+		{"<div class=\"a\">\n</div>", "html"},
+		{"<?xml version=\"1.0\"?>\n<a/>", "xml"},
+		{"package main\n\nimport \"fmt\"", "go"},
+		{"x := 1\nfmt.Println(x)", "go"},
+		{"fn main() {\n    let mut x = 1;\n}", "rust"},
+		{"#include <iostream>\nint main() { std::cout << 1; }", "cpp"},
+		{"#include <stdio.h>\nint main() { printf(\"1\"); }", "c"},
+		{"public class Main {\n}", "java"},
+		{"def hello(name):\n    print(name)", "python"},
+		{"import os\nprint(os.getcwd())", "python"},
+		{"const a = 1;\nconsole.log(a);", "javascript"},
+		{"SELECT id, name\nFROM users\nWHERE id = 1;", "sql"},
+		{"FROM golang:1.20 AS build\nRUN go build ./...", "dockerfile"},
+		{"#!/bin/bash\necho hi", "bash"},
+		{"$ go build\n$ ./app", "bash"},
+		{"git clone https://example.com/a.git", "bash"},
+		{"name: app\nversion: 1.0\n# comment\nitems:\n  - a", "yaml"},
+		{"name: app", ""},
+		{"", ""},
+		{"这是一段普通的文字", ""},
+	}
+	for _, tt := range tests {
+		if got := inferLanguage(tt.code); got != tt.want {
+			t.Errorf("inferLanguage(%q) = %q, want %q", tt.code, got, tt.want)
+		}
+	}
+}
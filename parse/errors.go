@@ -0,0 +1,59 @@
+package parse
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	// ErrNotWechatPage 页面中找不到公众号文章正文（#js_content）
+	ErrNotWechatPage = errors.New("not a wechat mp article page")
+	// ErrArticleDeleted 文章已被发布者删除或因违规无法查看
+	ErrArticleDeleted = errors.New("wechat mp article has been deleted")
+	// ErrImageLimit 图片数量或大小超过了 Options.Limits 的限制
+	ErrImageLimit = errors.New("image limit exceeded")
+	// ErrHotlinkPlaceholder 图片被防盗链拦截，返回的是占位图
+	ErrHotlinkPlaceholder = errors.New("got anti-hotlink placeholder instead of image")
+)
+
+// NetworkError 请求过程中的网络错误（DNS、连接、超时、读取响应等）
+type NetworkError struct {
+	URL string
+	Err error
+}
+
+func (e *NetworkError) Error() string {
+	return fmt.Sprintf("request %s error: %v", e.URL, e.Err)
+}
+
+func (e *NetworkError) Unwrap() error {
+	return e.Err
+}
+
+// HTTPStatusError 服务端返回了非 200 的状态码
+type HTTPStatusError struct {
+	URL        string
+	StatusCode int
+	Status     string
+	// RetryAfter 服务端通过 Retry-After 要求的等待时间，没有时为 0
+	RetryAfter time.Duration
+}
+
+func (e *HTTPStatusError) Error() string {
+	return fmt.Sprintf("get from url %s error: %s", e.URL, e.Status)
+}
+
+// ImageError 下载失败的图片
+type ImageError struct {
+	URL string
+	Err error
+}
+
+func (e *ImageError) Error() string {
+	return fmt.Sprintf("image %s: %v", e.URL, e.Err)
+}
+
+func (e *ImageError) Unwrap() error {
+	return e.Err
+}
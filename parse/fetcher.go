@@ -0,0 +1,108 @@
+package parse
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// ResourceKind 请求的资源类型
+type ResourceKind int32
+
+const (
+	RESOURCE_PAGE  ResourceKind = iota // 文章页面html
+	RESOURCE_IMAGE                     // 文章内图片
+)
+
+// FetchRequest 一次资源请求
+type FetchRequest struct {
+	URL    string
+	Kind   ResourceKind
+	Header http.Header
+}
+
+// FetchResponse 请求成功时返回的资源内容
+type FetchResponse struct {
+	// URL 资源的最终地址（重定向后）
+	URL    string
+	Header http.Header
+	Body   []byte
+}
+
+// Fetcher 负责获取文章页面和图片，parse 包所有的网络访问都经过它。
+// 可以替换成带缓存的、读本地镜像的、或对请求签名的实现。
+// 请求失败时应返回 *NetworkError 或 *HTTPStatusError，以便调用方区分错误类型。
+type Fetcher interface {
+	Fetch(ctx context.Context, req *FetchRequest) (*FetchResponse, error)
+}
+
+// FetcherFunc 让普通函数实现 Fetcher 接口
+type FetcherFunc func(ctx context.Context, req *FetchRequest) (*FetchResponse, error)
+
+func (f FetcherFunc) Fetch(ctx context.Context, req *FetchRequest) (*FetchResponse, error) {
+	return f(ctx, req)
+}
+
+// HTTPFetcher 默认的 Fetcher，通过 http.Client 请求资源
+type HTTPFetcher struct {
+	Client *http.Client
+}
+
+// NewHTTPFetcher 创建 HTTPFetcher，proxy 格式为 ip:port，为空则不使用代理
+func NewHTTPFetcher(proxy string) (*HTTPFetcher, error) {
+	// 超时由 ctx 控制，这里不设置 Client.Timeout
+	client := &http.Client{}
+
+	// 如果提供了代理，设置代理
+	if proxy != "" {
+		proxyURL, err := url.Parse("http://" + proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy format %s: %w", proxy, err)
+		}
+		client.Transport = &http.Transport{
+			Proxy: http.ProxyURL(proxyURL),
+			// 设置连接超时
+			DialContext: (&net.Dialer{
+				Timeout:   30 * time.Second,
+				KeepAlive: 30 * time.Second,
+			}).DialContext,
+			// 设置空闲连接超时
+			IdleConnTimeout:       90 * time.Second,
+			TLSHandshakeTimeout:   30 * time.Second,
+			ResponseHeaderTimeout: 30 * time.Second,
+		}
+	}
+	return &HTTPFetcher{Client: client}, nil
+}
+
+func (f *HTTPFetcher) Fetch(ctx context.Context, fr *FetchRequest) (*FetchResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", fr.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range fr.Header {
+		req.Header[k] = v
+	}
+	res, err := f.Client.Do(req)
+	if err != nil {
+		return nil, &NetworkError{URL: fr.URL, Err: err}
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		return nil, &HTTPStatusError{
+			URL:        fr.URL,
+			StatusCode: res.StatusCode,
+			Status:     res.Status,
+			RetryAfter: parseRetryAfter(res.Header.Get("Retry-After")),
+		}
+	}
+	content, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, &NetworkError{URL: fr.URL, Err: err}
+	}
+	return &FetchResponse{URL: res.Request.URL.String(), Header: res.Header, Body: content}, nil
+}
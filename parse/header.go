@@ -0,0 +1,155 @@
+package parse
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/fengxxc/wechatmp2markdown/util"
+)
+
+// HeaderProfile 请求页面和图片时携带的浏览器请求头，为空的字段使用 DefaultHeaderProfile 中的值
+type HeaderProfile struct {
+	UserAgent string
+	// Accept 请求文章页面时的 Accept
+	Accept string
+	// ImageAccept 请求图片时的 Accept
+	ImageAccept    string
+	AcceptLanguage string
+	// Referer 请求图片时的 Referer，为空时使用文章的url（mmbiz.qpic.cn 会校验 Referer 防盗链）
+	Referer string
+}
+
+// DefaultHeaderProfile 模拟桌面版 Edge 浏览器
+var DefaultHeaderProfile = HeaderProfile{
+	UserAgent:      "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/133.0.0.0 Safari/537.36 Edg/133.0.0.0",
+	Accept:         "text/html,application/xhtml+xml,application/xml;q=0.9,image/webp,*/*;q=0.8",
+	ImageAccept:    "image/avif,image/webp,image/apng,image/svg+xml,image/*,*/*;q=0.8",
+	AcceptLanguage: "zh-CN,zh;q=0.9,en;q=0.8",
+}
+
+// 微信文章的默认 Referer，无法得知文章url时使用
+const wechatReferer = "https://mp.weixin.qq.com/"
+
+func (hp HeaderProfile) withDefaults() HeaderProfile {
+	if hp.UserAgent == "" {
+		hp.UserAgent = DefaultHeaderProfile.UserAgent
+	}
+	if hp.Accept == "" {
+		hp.Accept = DefaultHeaderProfile.Accept
+	}
+	if hp.ImageAccept == "" {
+		hp.ImageAccept = DefaultHeaderProfile.ImageAccept
+	}
+	if hp.AcceptLanguage == "" {
+		hp.AcceptLanguage = DefaultHeaderProfile.AcceptLanguage
+	}
+	return hp
+}
+
+// pageHeader 请求文章页面的请求头
+func (hp HeaderProfile) pageHeader() http.Header {
+	header := http.Header{}
+	header.Set("User-Agent", hp.UserAgent)
+	header.Set("Accept", hp.Accept)
+	header.Set("Accept-Language", hp.AcceptLanguage)
+	if hp.Referer != "" {
+		header.Set("Referer", hp.Referer)
+	}
+	return header
+}
+
+// imageHeader 请求图片的请求头，pageURL 为图片所在文章的url
+func (hp HeaderProfile) imageHeader(pageURL string) http.Header {
+	header := http.Header{}
+	header.Set("User-Agent", hp.UserAgent)
+	header.Set("Accept", hp.ImageAccept)
+	header.Set("Accept-Language", hp.AcceptLanguage)
+	referer := hp.Referer
+	if referer == "" {
+		referer = pageURL
+	}
+	if referer == "" {
+		referer = wechatReferer
+	}
+	header.Set("Referer", referer)
+	return header
+}
+
+// hotlinkProbeReferer 探测防盗链占位图时使用的外站 Referer
+const hotlinkProbeReferer = "https://example.com/"
+
+// DefaultHotlinkDetector 判断下载到的是否为防盗链占位图而不是原图：返回的不是图片，或者被重定向到了其他host。
+// 以图片形式返回的占位图（“此图片来自微信公众平台 未经允许不可引用”）由解析时探测到的占位图及
+// Options.ProbeHotlink 探测到的占位图识别，见 parser.isHotlinkPlaceholder
+func DefaultHotlinkDetector(req *FetchRequest, res *FetchResponse) bool {
+	contentType := res.Header.Get("Content-Type")
+	if contentType != "" && !strings.HasPrefix(contentType, "image/") && !strings.HasPrefix(contentType, "application/octet-stream") {
+		return true
+	}
+	if res.URL != "" && res.URL != req.URL {
+		reqURL, err1 := url.Parse(req.URL)
+		resURL, err2 := url.Parse(res.URL)
+		if err1 == nil && err2 == nil && reqURL.Host != resURL.Host {
+			return true
+		}
+	}
+	return false
+}
+
+// isMmbizURL 是否为公众号的图片地址（mmbiz.qpic.cn）
+func isMmbizURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	return err == nil && strings.HasSuffix(strings.ToLower(u.Host), "mmbiz.qpic.cn")
+}
+
+// hotlinkPlaceholder 用外站 Referer 请求文章中两张不同的公众号图片，内容相同时即为防盗链占位图，返回它的md5。
+// 只带查询参数、尺寸不同的地址是同一张图片（resourceKey 相同），不能用来比较。
+// 每次解析只探测一次，不同的图片少于两张或防盗链没有生效时返回空字符串
+func (p *parser) hotlinkPlaceholder() string {
+	p.hotlinkOnce.Do(func() {
+		var urls []string
+		for _, src := range p.imageURLs {
+			if !isMmbizURL(src) || p.isOffline(src) {
+				continue
+			}
+			if len(urls) == 1 && resourceKey(urls[0]) == resourceKey(src) {
+				continue
+			}
+			urls = append(urls, src)
+			if len(urls) == 2 {
+				break
+			}
+		}
+		if len(urls) < 2 {
+			return
+		}
+		var digests []string
+		for _, src := range urls {
+			header := p.opts.HeaderProfile.imageHeader(p.pageURL)
+			header.Set("Referer", hotlinkProbeReferer)
+			res, err := p.fetch(&FetchRequest{URL: src, Kind: RESOURCE_IMAGE, Header: header})
+			if err != nil {
+				return
+			}
+			digests = append(digests, util.MD5(res.Body))
+		}
+		if digests[0] == digests[1] {
+			p.hotlinkDigest = digests[0]
+		}
+	})
+	return p.hotlinkDigest
+}
+
+// isHotlinkPlaceholder 下载到的图片是否为 Options.HotlinkPlaceholderDigests 中的或探测到的占位图
+func (p *parser) isHotlinkPlaceholder(imgURL string, res *FetchResponse) bool {
+	digest := util.MD5(res.Body)
+	if p.placeholderDigests[digest] {
+		return true
+	}
+	if !p.opts.ProbeHotlink || !isMmbizURL(imgURL) {
+		return false
+	}
+	placeholder := p.hotlinkPlaceholder()
+	return placeholder != "" && placeholder == digest
+}
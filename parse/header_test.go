@@ -0,0 +1,125 @@
+package parse
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/fengxxc/wechatmp2markdown/util"
+)
+
+const hotlinkTestPage = `<html><body><div id="img-content">
+<h1 id="activity-name">标题</h1>
+<div id="js_content">
+<p><img data-src="https://mmbiz.qpic.cn/mmbiz_png/a/640"></p>
+<p><img data-src="https://mmbiz.qpic.cn/mmbiz_png/b/640"></p>
+</div></div></body></html>`
+
+// 同一张图片出现两次，地址只有查询参数不同
+const hotlinkDuplicatePage = `<html><body><div id="img-content">
+<h1 id="activity-name">标题</h1>
+<div id="js_content">
+<p><img data-src="https://mmbiz.qpic.cn/mmbiz_png/a/640?wx_fmt=png"></p>
+<p><img data-src="https://mmbiz.qpic.cn/mmbiz_png/a/640?wx_fmt=png&amp;from=appmsg"></p>
+</div></div></body></html>`
+
+func TestHotlinkPlaceholder(t *testing.T) {
+	tests := []struct {
+		name string
+		page string
+		// probe 是否开启 Options.ProbeHotlink
+		probe bool
+		// blocked 用文章的 Referer 请求时返回占位图的图片
+		blocked map[string]bool
+		// protected 防盗链是否生效，不生效时外站 Referer 也能得到原图
+		protected  bool
+		digests    []string
+		wantFails  []string
+		wantProbes int
+	}{
+		{
+			name:       "blocked image detected by probe",
+			probe:      true,
+			blocked:    map[string]bool{"b": true},
+			protected:  true,
+			wantFails:  []string{"b"},
+			wantProbes: 2,
+		},
+		{
+			name:       "no protection, nothing to detect",
+			probe:      true,
+			protected:  false,
+			wantProbes: 2,
+		},
+		{
+			name:       "all images fine",
+			probe:      true,
+			protected:  true,
+			wantProbes: 2,
+		},
+		{
+			name:      "probing is off by default",
+			blocked:   map[string]bool{"b": true},
+			protected: true,
+		},
+		{
+			name:      "same image twice is not a placeholder",
+			page:      hotlinkDuplicatePage,
+			probe:     true,
+			protected: false,
+		},
+		{
+			name:      "known digest from options",
+			blocked:   map[string]bool{"a": true},
+			digests:   []string{"00000000000000000000000000000000", util.MD5([]byte("placeholder"))},
+			wantFails: []string{"a"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			probes := 0
+			fetcher := FetcherFunc(func(ctx context.Context, req *FetchRequest) (*FetchResponse, error) {
+				id := strings.Split(req.URL, "/")[4]
+				body := "image-" + id
+				if req.Header.Get("Referer") == hotlinkProbeReferer {
+					mu.Lock()
+					probes++
+					mu.Unlock()
+					if tt.protected {
+						body = "placeholder"
+					}
+				} else if tt.blocked[id] {
+					body = "placeholder"
+				}
+				return &FetchResponse{URL: req.URL, Header: http.Header{"Content-Type": {"image/png"}}, Body: []byte(body)}, nil
+			})
+			page := tt.page
+			if page == "" {
+				page = hotlinkTestPage
+			}
+			article, err := ParseReader(context.Background(), strings.NewReader(page), Options{
+				ImagePolicy:               IMAGE_POLICY_BASE64,
+				Fetcher:                   fetcher,
+				ProbeHotlink:              tt.probe,
+				HotlinkPlaceholderDigests: tt.digests,
+				Retry:                     RetryPolicy{MaxRetries: -1},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var fails []string
+			for _, imgErr := range article.FailedImages {
+				fails = append(fails, strings.Split(imgErr.URL, "/")[4])
+			}
+			if strings.Join(fails, ",") != strings.Join(tt.wantFails, ",") {
+				t.Errorf("failed images = %v, want %v", fails, tt.wantFails)
+			}
+			if probes != tt.wantProbes {
+				t.Errorf("probe requests = %d, want %d", probes, tt.wantProbes)
+			}
+		})
+	}
+}
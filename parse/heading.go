@@ -0,0 +1,306 @@
+package parse
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// HeadingDetection 正文中标题的识别方式
+type HeadingDetection int32
+
+const (
+	HEADING_DETECTION_AUTO HeadingDetection = iota // 除 h1~h6 外，还根据字号、粗体、居中和编号推断标题
+	HEADING_DETECTION_OFF                          // 只识别 h1~h6
+)
+
+func HeadingArgValue2HeadingDetection(val string) HeadingDetection {
+	var detection HeadingDetection
+	switch val {
+	case "off":
+		detection = HEADING_DETECTION_OFF
+	case "auto":
+		fallthrough
+	default:
+		detection = HEADING_DETECTION_AUTO
+	}
+	return detection
+}
+
+// HeadingOptions 推断标题的参数，值为 0 时使用默认值
+type HeadingOptions struct {
+	// Detection 标题的识别方式
+	Detection HeadingDetection
+	// MinFontSize 字号（px）不小于该值的独立短行视为标题，默认为 18
+	MinFontSize float64
+	// MaxLength 标题的最大字数，默认为 40
+	MaxLength int
+	// TopLevel 推断出的最高一级标题的级别，默认为 2（1 级是文章标题）
+	TopLevel int
+}
+
+func (ho HeadingOptions) withDefaults() HeadingOptions {
+	if ho.MinFontSize <= 0 {
+		ho.MinFontSize = 18
+	}
+	if ho.MaxLength <= 0 {
+		ho.MaxLength = 40
+	}
+	if ho.TopLevel <= 0 || ho.TopLevel > 6 {
+		ho.TopLevel = 2
+	}
+	return ho
+}
+
+// 标题的编号，按层级从高到低排列，如 “第一章”、“01”、“一、”、“（一）”、“1.”、“（1）”。
+// “01 引言” 这样两位数字的编号多用于划分文章的大段落，排在 “一、” 之前；“01.” 与 “1.” 相同
+var headingNumberRegs = []*regexp.Regexp{
+	regexp.MustCompile(`^(?i:第[一二三四五六七八九十百零〇\d]+[章部篇节]|part\s*\d+|chapter\s*\d+)`),
+	regexp.MustCompile(`^0\d(\s|$|[^\d.．、])`),
+	regexp.MustCompile(`^[一二三四五六七八九十]+\s*[、.．]`),
+	regexp.MustCompile(`^[（(][一二三四五六七八九十]+[)）]`),
+	regexp.MustCompile(`^\d{1,2}\s*[、.．]`),
+	regexp.MustCompile(`^[（(]\d{1,2}[)）]`),
+}
+
+// 排列级别时，没有编号的标题与 “一、” 同级，同级的按字号从大到小排列
+const headingNoNumber = 2
+
+// 单独一行的两位数字编号，与下一行的标题合并，如 <p><strong>01</strong></p><p><strong>引言</strong></p>
+var standaloneNumberReg = regexp.MustCompile(`^0\d$`)
+
+// headingNumber 返回标题编号在 headingNumberRegs 中的层级，没有编号时返回 -1
+func headingNumber(text string) int {
+	for i, reg := range headingNumberRegs {
+		if reg.MatchString(text) {
+			return i
+		}
+	}
+	return -1
+}
+
+// standaloneNumber 单独一行的编号，见 standaloneNumberReg
+type standaloneNumber struct {
+	text  string
+	start int
+}
+
+// headingStyle 推断出的标题的样式，样式相同的标题级别相同。
+// 有编号的标题只按编号区分（fontSize 为 0），没有编号的标题（number 为 -1）按字号区分
+type headingStyle struct {
+	fontSize float64
+	number   int
+}
+
+// rank 排列级别时的编号层级
+func (hs headingStyle) rank() int {
+	if hs.number < 0 {
+		return headingNoNumber
+	}
+	return hs.number
+}
+
+// headingCandidate 推断出的标题，fontSize 为标题的字号，fallback 为不作为标题时原本的内容
+type headingCandidate struct {
+	style    headingStyle
+	fontSize float64
+	fallback []Piece
+	attrs    map[string]string
+}
+
+// 标题末尾不会出现的标点
+const headingEndPunct = "。，；、,;"
+
+// inferHeading 判断不含其它块级元素的段落是否为标题：字号较大，或者粗体且居中或带编号，或者以 “一、” 等编号开头。
+// prefix 为上一行单独的编号（见 standaloneNumberReg），没有时为空字符串。
+// 是标题时返回 HEADER，级别在 assignHeadingLevels 中确定；fallback 为段落（及 prefix 所在行）原本的内容
+func (p *parser) inferHeading(s *goquery.Selection, prefix string, fallback []Piece) (Piece, bool) {
+	opts := p.opts.Headings
+	if opts.Detection == HEADING_DETECTION_OFF || s.Find(blockSelector).Length() > 0 || s.Find("img").Length() > 0 {
+		return Piece{}, false
+	}
+	// 列表、引用、表格中的段落不是标题
+	if s.Closest("li, blockquote, table").Length() > 0 {
+		return Piece{}, false
+	}
+	text := removeBrAndBlank(s.Text())
+	if text == "" {
+		return Piece{}, false
+	}
+	if prefix != "" {
+		text = prefix + " " + text
+	} else {
+		p.lineCount++
+	}
+	if utf8.RuneCountInString(text) > opts.MaxLength || strings.ContainsAny(lastRune(text), headingEndPunct) || !hasLetter(text) {
+		return Piece{}, false
+	}
+	fontSize, bold := textStyle(s)
+	centered := isCentered(s)
+	number := headingNumber(text)
+	isHeading := fontSize >= opts.MinFontSize ||
+		bold && (centered || number >= 0) ||
+		number >= 0 && number <= headingNoNumber && utf8.RuneCountInString(text) <= opts.MaxLength/2
+	if !isHeading {
+		return Piece{}, false
+	}
+	style := headingStyle{number: number}
+	if number < 0 {
+		style.fontSize = fontSize
+	}
+	attrs := map[string]string{"level": "", "heading-candidate": strconv.Itoa(len(p.headings))}
+	p.headings = append(p.headings, headingCandidate{
+		style:    style,
+		fontSize: fontSize,
+		fallback: fallback,
+		attrs:    attrs,
+	})
+	return Piece{HEADER, text, attrs}, true
+}
+
+// assignHeadingLevels 按编号层级从高到低为推断出的标题分配级别，编号相同的标题级别相同，不受字号影响；
+// 没有编号的标题与 “一、” 同级，按字号从大到小排列。
+// 某种样式的标题超过正文行数的一半时，说明这是正文的样式，还原为原本的内容
+func (p *parser) assignHeadingLevels(pieces []Piece) []Piece {
+	if len(p.headings) == 0 {
+		return pieces
+	}
+	counts := make(map[headingStyle]int)
+	// fontSizes 每种样式的标题的最大字号，同一层级中有编号和没有编号的标题按字号排列
+	fontSizes := make(map[headingStyle]float64)
+	for _, h := range p.headings {
+		counts[h.style]++
+		if h.fontSize > fontSizes[h.style] {
+			fontSizes[h.style] = h.fontSize
+		}
+	}
+	var styles []headingStyle
+	for style, count := range counts {
+		if count*2 <= p.lineCount {
+			styles = append(styles, style)
+		}
+	}
+	sort.Slice(styles, func(i, j int) bool {
+		if styles[i].rank() != styles[j].rank() {
+			return styles[i].rank() < styles[j].rank()
+		}
+		if fontSizes[styles[i]] != fontSizes[styles[j]] {
+			return fontSizes[styles[i]] > fontSizes[styles[j]]
+		}
+		return styles[i].number > styles[j].number
+	})
+	levels := make(map[headingStyle]int)
+	for i, style := range styles {
+		levels[style] = p.opts.Headings.TopLevel + i
+		if levels[style] > 6 {
+			levels[style] = 6
+		}
+	}
+
+	var res []Piece
+	for _, piece := range pieces {
+		idx, err := strconv.Atoi(piece.Attrs["heading-candidate"])
+		if piece.Type != HEADER || err != nil {
+			res = append(res, piece)
+			continue
+		}
+		h := p.headings[idx]
+		delete(h.attrs, "heading-candidate")
+		if level, ok := levels[h.style]; ok {
+			h.attrs["level"] = strconv.Itoa(level)
+			res = append(res, piece)
+		} else {
+			res = append(res, h.fallback...)
+		}
+	}
+	return res
+}
+
+// textStyle 返回元素中所有文字的最小字号（没有设置字号的文字为 0）以及文字是否都为粗体
+func textStyle(s *goquery.Selection) (float64, bool) {
+	fontSize, bold := -1.0, true
+	s.Find("*").AddBack().Contents().Each(func(i int, sc *goquery.Selection) {
+		if goquery.NodeName(sc) != "#text" || strings.TrimSpace(sc.Text()) == "" {
+			return
+		}
+		size, isBold := 0.0, false
+		sizeFound, boldFound := false, false
+		for el := sc.Parent(); el.Length() > 0 && !el.Is("#js_content"); el = el.Parent() {
+			style := parseStyle(el.AttrOr("style", ""))
+			if !sizeFound {
+				if val, ok := style["font-size"]; ok {
+					size, sizeFound = parseLength(val), true
+				}
+			}
+			if !boldFound {
+				if el.Is("strong, b") {
+					isBold, boldFound = true, true
+				} else if weight, ok := style["font-weight"]; ok {
+					isBold, boldFound = isBoldWeight(weight), true
+				}
+			}
+			if sizeFound && boldFound {
+				break
+			}
+		}
+		if fontSize < 0 || size < fontSize {
+			fontSize = size
+		}
+		bold = bold && isBold
+	})
+	if fontSize < 0 {
+		fontSize = 0
+	}
+	return fontSize, bold
+}
+
+// isCentered 元素自身或其所在的块是否居中
+func isCentered(s *goquery.Selection) bool {
+	for el := s; el.Length() > 0 && !el.Is("#js_content"); el = el.Parent() {
+		if align, ok := parseStyle(el.AttrOr("style", ""))["text-align"]; ok {
+			return align == "center"
+		}
+		if align, ok := el.Attr("align"); ok {
+			return strings.EqualFold(align, "center")
+		}
+	}
+	return false
+}
+
+// parseLength 把 px、pt、em、rem 表示的字号、长度换算为 px，无法识别时返回 0
+func parseLength(val string) float64 {
+	units := []struct {
+		suffix string
+		ratio  float64
+	}{{"px", 1}, {"pt", 4.0 / 3}, {"rem", 16}, {"em", 16}}
+	for _, unit := range units {
+		if num, ok := strings.CutSuffix(val, unit.suffix); ok {
+			size, err := strconv.ParseFloat(strings.TrimSpace(num), 64)
+			if err != nil {
+				return 0
+			}
+			return size * unit.ratio
+		}
+	}
+	return 0
+}
+
+func lastRune(s string) string {
+	r, _ := utf8.DecodeLastRuneInString(s)
+	return string(r)
+}
+
+// hasLetter 是否包含文字，只有编号或符号的行不是标题
+func hasLetter(s string) bool {
+	for _, r := range s {
+		if unicode.IsLetter(r) {
+			return true
+		}
+	}
+	return false
+}
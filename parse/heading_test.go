@@ -0,0 +1,161 @@
+package parse
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestHeadingNumber(t *testing.T) {
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"第一章 开始", 0},
+		{"第3节 小结", 0},
+		{"Part 2 进阶", 0},
+		{"Chapter 1 Intro", 0},
+		{"01 引言", 1},
+		{"02引言", 1},
+		{"03", 1},
+		{"一、背景", 2},
+		{"十二. 总结", 2},
+		{"（一）原因", 3},
+		{"(二)结果", 3},
+		{"1. 安装", 4},
+		{"12、配置", 4},
+		{"01. 准备", 4},
+		{"（1）步骤", 5},
+		{"(10)步骤", 5},
+		{"2023年的总结", -1},
+		{"100. 不是编号", -1},
+		{"背景", -1},
+	}
+	for _, tt := range tests {
+		if got := headingNumber(tt.text); got != tt.want {
+			t.Errorf("headingNumber(%q) = %d, want %d", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestParseLength(t *testing.T) {
+	tests := []struct {
+		val  string
+		want float64
+	}{
+		{"18px", 18},
+		{"12pt", 16},
+		{"1.5em", 24},
+		{"1rem", 16},
+		{" 20 px", 20},
+		{"large", 0},
+		{"px", 0},
+		{"", 0},
+	}
+	for _, tt := range tests {
+		if got := parseLength(tt.val); got != tt.want {
+			t.Errorf("parseLength(%q) = %v, want %v", tt.val, got, tt.want)
+		}
+	}
+}
+
+// headingTestBody 正文行数足够多，使推断出的标题不会被当作正文的样式
+var headingTestBody = strings.Repeat("<p>这是正文的内容。</p>", 12)
+
+func TestInferHeadingLevels(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		opts    HeadingOptions
+		// want 按顺序排列的标题，形如 “3 一、背景”
+		want []string
+	}{
+		{
+			name: "numbered siblings share a level regardless of font size",
+			content: `<p style="font-size:20px"><strong>一、背景</strong></p>` + headingTestBody +
+				`<p style="font-size:16px"><strong>1. 细节</strong></p>` +
+				`<p style="font-size:18px"><strong>二、方案</strong></p>` +
+				`<p style="font-size:15px"><strong>（一）子方案</strong></p>`,
+			want: []string{"2 一、背景", "4 1. 细节", "2 二、方案", "3 （一）子方案"},
+		},
+		{
+			name: "unnumbered headings ranked by font size",
+			content: `<p style="font-size:24px">大标题</p>` + headingTestBody +
+				`<p style="font-size:20px">中标题</p>` +
+				`<p style="font-size:24px">另一个大标题</p>`,
+			want: []string{"2 大标题", "3 中标题", "2 另一个大标题"},
+		},
+		{
+			name: "chapter above unnumbered",
+			content: `<p style="font-size:18px"><strong>第一章 开始</strong></p>` + headingTestBody +
+				`<p style="font-size:24px">没有编号</p>`,
+			want: []string{"2 第一章 开始", "3 没有编号"},
+		},
+		{
+			name: "two digit number in the same line",
+			content: `<p><strong>01 引言</strong></p>` + headingTestBody +
+				`<p><strong>一、背景</strong></p>` +
+				`<p><strong>02 方法</strong></p>`,
+			want: []string{"2 01 引言", "3 一、背景", "2 02 方法"},
+		},
+		{
+			name: "two digit number in its own line",
+			content: `<p><strong>01</strong></p>` + "\n" + `<p><strong>引言</strong></p>` + headingTestBody +
+				`<p style="font-size:20px"><strong>02</strong></p><p style="font-size:16px"><strong>方法</strong></p>`,
+			want: []string{"2 01 引言", "2 02 方法"},
+		},
+		{
+			name:    "standalone number followed by a sentence",
+			content: `<p><strong>01</strong></p><p>这是一句话。</p>` + headingTestBody,
+		},
+		{
+			name:    "top level option",
+			content: `<p>一、背景</p>` + headingTestBody + `<p><strong>（一）原因</strong></p>`,
+			opts:    HeadingOptions{TopLevel: 3},
+			want:    []string{"3 一、背景", "4 （一）原因"},
+		},
+		{
+			name:    "sentences and list items are not headings",
+			content: `<p style="font-size:20px">这是一句话。</p><ul><li><strong>一、列表</strong></li></ul>` + headingTestBody,
+		},
+		{
+			name:    "body style is not a heading",
+			content: strings.Repeat(`<p style="font-size:20px">正文</p>`, 3) + `<p style="font-size:20px">一句话。</p>`,
+		},
+		{
+			name:    "detection off",
+			content: `<p style="font-size:24px">大标题</p>` + headingTestBody,
+			opts:    HeadingOptions{Detection: HEADING_DETECTION_OFF},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page := `<html><body><div id="img-content"><h1 id="activity-name">标题</h1><div id="js_content">` +
+				tt.content + `</div></div></body></html>`
+			article, err := ParseReader(context.Background(), strings.NewReader(page), Options{
+				ImagePolicy: IMAGE_POLICY_URL,
+				Headings:    tt.opts,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, piece := range article.Content {
+				if piece.Type == HEADER {
+					got = append(got, piece.Attrs["level"]+" "+piece.Val.(string))
+				}
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("headings = %q, want %q", got, tt.want)
+			}
+			// 合并到标题中的编号不再单独出现在正文中
+			for _, h := range tt.want {
+				if number, _, ok := strings.Cut(h[2:], " "); ok && standaloneNumberReg.MatchString(number) {
+					if n := strings.Count(article.ToString(), number); n != 1 {
+						t.Errorf("%q appears %d times in content", number, n)
+					}
+				}
+			}
+		})
+	}
+}
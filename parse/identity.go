@@ -0,0 +1,101 @@
+package parse
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// ArticleID 公众号文章的唯一标识，同一篇文章的长链接、短链接都对应同一个 ArticleID
+type ArticleID struct {
+	Biz string // 公众号，对应url中的 __biz
+	Mid string // 图文消息id
+	Idx string // 在图文消息中的序号，从1开始
+	SN  string // 签名
+}
+
+// IsZero 是否未能识别出文章标识
+func (id ArticleID) IsZero() bool {
+	return id.Biz == "" && id.Mid == "" && id.SN == ""
+}
+
+// Key 用作索引的字符串形式
+func (id ArticleID) Key() string {
+	if id.IsZero() {
+		return ""
+	}
+	return id.Biz + "/" + id.Mid + "/" + id.Idx + "/" + id.SN
+}
+
+// ParseArticleID 从文章长链接中解析出 ArticleID，短链接（/s/xxxx）无法解析，返回 false
+func ParseArticleID(rawURL string) (ArticleID, bool) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ArticleID{}, false
+	}
+	// 公众号链接中常见 &amp; 转义
+	query, err := url.ParseQuery(strings.ReplaceAll(u.RawQuery, "&amp;", "&"))
+	if err != nil {
+		return ArticleID{}, false
+	}
+	id := ArticleID{
+		Biz: query.Get("__biz"),
+		Mid: query.Get("mid"),
+		Idx: query.Get("idx"),
+		SN:  query.Get("sn"),
+	}
+	return id, !id.IsZero()
+}
+
+// 文章页面js中的变量，如 var biz = "MzIzOTU0NTQ0MA==" || "";
+var (
+	scriptBizReg = regexp.MustCompile(`var\s+biz\s*=\s*"([^"]*)"`)
+	scriptMidReg = regexp.MustCompile(`var\s+mid\s*=\s*"([^"]*)"`)
+	scriptIdxReg = regexp.MustCompile(`var\s+idx\s*=\s*"([^"]*)"`)
+	scriptSnReg  = regexp.MustCompile(`var\s+sn\s*=\s*"([^"]*)"`)
+)
+
+// parseArticleID 依次从页面js、og:url、请求的url中解析文章标识
+func parseArticleID(doc *goquery.Document, pageURL string) ArticleID {
+	script := doc.Find("script").Text()
+	find := func(reg *regexp.Regexp) string {
+		if m := reg.FindStringSubmatch(script); len(m) > 1 {
+			return m[1]
+		}
+		return ""
+	}
+	id := ArticleID{
+		Biz: find(scriptBizReg),
+		Mid: find(scriptMidReg),
+		Idx: find(scriptIdxReg),
+		SN:  find(scriptSnReg),
+	}
+	if !id.IsZero() {
+		return id
+	}
+	if ogURL, ok := doc.Find(`meta[property="og:url"]`).Attr("content"); ok {
+		if id, ok := ParseArticleID(ogURL); ok {
+			return id
+		}
+	}
+	id, _ = ParseArticleID(pageURL)
+	return id
+}
+
+// contentHash 正文的摘要，由正文文本和图片地址计算，用来判断文章是否有修改
+func contentHash(content *goquery.Selection) string {
+	hash := sha256.New()
+	hash.Write([]byte(removeBrAndBlank(content.Text())))
+	content.Find("img").Each(func(i int, img *goquery.Selection) {
+		src, _ := img.Attr("data-src")
+		if src == "" {
+			src, _ = img.Attr("src")
+		}
+		hash.Write([]byte("\n" + src))
+	})
+	return hex.EncodeToString(hash.Sum(nil))
+}
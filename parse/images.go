@@ -0,0 +1,160 @@
+package parse
+
+import (
+	"context"
+	"log"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/fengxxc/wechatmp2markdown/util"
+)
+
+const defaultImageConcurrency = 4
+
+// addImage 登记正文中需要下载的图片，相同的url只下载一次；localPath 不为空时从本地文件读取
+func (p *parser) addImage(src string, localPath string) {
+	if p.images == nil {
+		p.images = make(map[string]*FetchResponse)
+		p.localImages = make(map[string]string)
+	}
+	if localPath != "" {
+		p.localImages[src] = localPath
+	}
+	if _, ok := p.images[src]; ok {
+		return
+	}
+	p.images[src] = nil
+	p.imageURLs = append(p.imageURLs, src)
+}
+
+// fetchImages 并发下载所有登记的图片，并发数和每个host的请求频率由 Options.Limits 控制，
+// 最终下载失败的图片按正文顺序返回
+func (p *parser) fetchImages() []ImageError {
+	urls := p.imageURLs
+	var skipped []string
+	if limit := p.opts.Limits.MaxImages; limit > 0 && len(urls) > limit {
+		urls, skipped = urls[:limit], urls[limit:]
+	}
+	concurrency := p.opts.Limits.MaxConcurrentImages
+	if concurrency <= 0 {
+		concurrency = defaultImageConcurrency
+	}
+	limiter := newHostLimiter(p.opts.Limits.PerHostRate)
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	errs := make(map[string]error)
+	jobs := make(chan string)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for src := range jobs {
+				if !p.isOffline(src) {
+					if err := limiter.wait(p.ctx, src); err != nil {
+						continue
+					}
+				}
+				res, err := p.fetchImgFile(src)
+				mu.Lock()
+				if err != nil {
+					errs[src] = err
+				} else {
+					p.images[src] = res
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, src := range urls {
+		if p.ctx.Err() != nil {
+			break
+		}
+		jobs <- src
+	}
+	close(jobs)
+	wg.Wait()
+
+	var failed []ImageError
+	for _, src := range urls {
+		if err, ok := errs[src]; ok {
+			log.Printf("get Image from url %s error: %s", src, err.Error())
+			failed = append(failed, ImageError{URL: src, Err: err})
+		}
+	}
+	for _, src := range skipped {
+		failed = append(failed, ImageError{URL: src, Err: ErrImageLimit})
+	}
+	return failed
+}
+
+// attachImages 把下载好的图片填回图片 Piece 中，并记录图片的MIME类型
+func (p *parser) attachImages(pieces []Piece) {
+	for i := range pieces {
+		switch pieces[i].Type {
+		case IMAGE, IMAGE_BASE64:
+			src := pieces[i].Attrs["src"]
+			res := p.images[src]
+			if res == nil {
+				if pieces[i].Type == IMAGE_BASE64 {
+					pieces[i].Val = ""
+				}
+				continue
+			}
+			pieces[i].Attrs["mime"] = util.DetectImageType(res.Body, res.Header.Get("Content-Type"), src)
+			if pieces[i].Type == IMAGE {
+				pieces[i].Val = res.Body
+			} else {
+				pieces[i].Val = img2base64(res.Body)
+			}
+		default:
+			if children, ok := pieces[i].Val.([]Piece); ok {
+				p.attachImages(children)
+			}
+		}
+	}
+}
+
+// hostLimiter 限制对同一个host的请求频率
+type hostLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     map[string]time.Time
+}
+
+// rate 为每个host每秒的请求数，<= 0 时不限制
+func newHostLimiter(rate float64) *hostLimiter {
+	l := &hostLimiter{next: make(map[string]time.Time)}
+	if rate > 0 {
+		l.interval = time.Duration(float64(time.Second) / rate)
+	}
+	return l
+}
+
+func (l *hostLimiter) wait(ctx context.Context, rawURL string) error {
+	if l.interval == 0 {
+		return ctx.Err()
+	}
+	var host string
+	if u, err := url.Parse(rawURL); err == nil {
+		host = u.Host
+	}
+	l.mu.Lock()
+	now := time.Now()
+	at := l.next[host]
+	if at.Before(now) {
+		at = now
+	}
+	l.next[host] = at.Add(l.interval)
+	l.mu.Unlock()
+
+	timer := time.NewTimer(at.Sub(now))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
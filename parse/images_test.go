@@ -0,0 +1,143 @@
+package parse
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// imagesPage 包含 n 张图片的页面，最后一张与第一张相同
+func imagesPage(n int) string {
+	var sb strings.Builder
+	sb.WriteString(`<html><body><div id="img-content"><h1 id="activity-name">图片</h1><div id="js_content">`)
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&sb, `<p><img data-src="https://example.com/%d.png"></p>`, i)
+	}
+	sb.WriteString(`<p><img data-src="https://example.com/0.png"></p></div></div></body></html>`)
+	return sb.String()
+}
+
+func TestFetchImagesLimits(t *testing.T) {
+	tests := []struct {
+		name        string
+		images      int
+		limits      Limits
+		wantFetched int
+		wantSkipped []string
+		// wantMaxInFlight 同时进行的请求数的上限
+		wantMaxInFlight int
+	}{
+		{
+			name:            "default concurrency",
+			images:          10,
+			wantFetched:     10,
+			wantMaxInFlight: defaultImageConcurrency,
+		},
+		{
+			name:            "concurrency 2",
+			images:          6,
+			limits:          Limits{MaxConcurrentImages: 2},
+			wantFetched:     6,
+			wantMaxInFlight: 2,
+		},
+		{
+			name:            "max images",
+			images:          5,
+			limits:          Limits{MaxImages: 3, MaxConcurrentImages: 1},
+			wantFetched:     3,
+			wantSkipped:     []string{"https://example.com/3.png", "https://example.com/4.png"},
+			wantMaxInFlight: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var inFlight, maxInFlight int
+			fetched := make(map[string]int)
+			fetcher := FetcherFunc(func(ctx context.Context, req *FetchRequest) (*FetchResponse, error) {
+				if req.Kind == RESOURCE_PAGE {
+					return &FetchResponse{URL: req.URL, Body: []byte(imagesPage(tt.images))}, nil
+				}
+				mu.Lock()
+				inFlight++
+				if inFlight > maxInFlight {
+					maxInFlight = inFlight
+				}
+				fetched[req.URL]++
+				mu.Unlock()
+				time.Sleep(10 * time.Millisecond)
+				mu.Lock()
+				inFlight--
+				mu.Unlock()
+				return &FetchResponse{URL: req.URL, Body: []byte(req.URL)}, nil
+			})
+			article, err := Parse(context.Background(), parserTestURL, Options{ImagePolicy: IMAGE_POLICY_BASE64, Fetcher: fetcher, Limits: tt.limits})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(fetched) != tt.wantFetched {
+				t.Errorf("fetched %d images, want %d", len(fetched), tt.wantFetched)
+			}
+			for src, n := range fetched {
+				if n != 1 {
+					t.Errorf("image %s fetched %d times", src, n)
+				}
+			}
+			if maxInFlight > tt.wantMaxInFlight {
+				t.Errorf("%d concurrent requests, want at most %d", maxInFlight, tt.wantMaxInFlight)
+			}
+			if tt.wantMaxInFlight > 1 && maxInFlight < 2 {
+				t.Errorf("images were not fetched concurrently")
+			}
+			var skipped []string
+			for _, failed := range article.FailedImages {
+				if !errors.Is(failed.Err, ErrImageLimit) {
+					t.Errorf("failed image %s: %v", failed.URL, failed.Err)
+				}
+				skipped = append(skipped, failed.URL)
+			}
+			if strings.Join(skipped, ",") != strings.Join(tt.wantSkipped, ",") {
+				t.Errorf("skipped images = %v, want %v", skipped, tt.wantSkipped)
+			}
+			// 超出数量限制的图片退回原本的url
+			images := archiveImages(article)
+			for _, src := range tt.wantSkipped {
+				if images[src] != "" {
+					t.Errorf("skipped image %s has content", src)
+				}
+			}
+			if images["https://example.com/0.png"] != "https://example.com/0.png" {
+				t.Errorf("first image = %q", images["https://example.com/0.png"])
+			}
+		})
+	}
+}
+
+func TestFetchImagesCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var mu sync.Mutex
+	var requests int
+	fetcher := FetcherFunc(func(ctx context.Context, req *FetchRequest) (*FetchResponse, error) {
+		if req.Kind == RESOURCE_PAGE {
+			return &FetchResponse{URL: req.URL, Body: []byte(imagesPage(20))}, nil
+		}
+		mu.Lock()
+		requests++
+		mu.Unlock()
+		// 第一张图片开始下载后取消，之后的图片不再请求
+		cancel()
+		return nil, ctx.Err()
+	})
+	_, err := Parse(ctx, parserTestURL, Options{ImagePolicy: IMAGE_POLICY_BASE64, Fetcher: fetcher, Limits: Limits{MaxConcurrentImages: 1}})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+	if requests > 2 {
+		t.Errorf("%d image requests after cancel", requests)
+	}
+}
@@ -0,0 +1,140 @@
+package parse
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// ParseFile 解析本地保存的文章，例如浏览器“网页，全部”另存为的html文件。
+// 图片优先从同目录下的 xxx_files 文件夹中读取，找不到时再按原地址下载。
+// .mhtml/.mht 和 .warc/.warc.gz 文件分别按 ParseMHTML、ParseWARC 解析。
+func (ps *Parser) ParseFile(ctx context.Context, path string) (Article, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return Article{}, err
+	}
+	file, err := os.Open(absPath)
+	if err != nil {
+		return Article{}, err
+	}
+	defer file.Close()
+	switch name := strings.ToLower(absPath); {
+	case strings.HasSuffix(name, ".mhtml") || strings.HasSuffix(name, ".mht"):
+		return ps.ParseMHTML(ctx, file)
+	case strings.HasSuffix(name, ".warc") || strings.HasSuffix(name, ".warc.gz"):
+		return ps.ParseWARC(ctx, file)
+	}
+	p := ps.newParser(ctx)
+	p.baseDir = filepath.Dir(absPath)
+	return p.parseDocument(file)
+}
+
+// ParseFile 解析本地保存的文章html
+func ParseFile(ctx context.Context, path string, opts Options) (Article, error) {
+	p, err := NewParser(opts)
+	if err != nil {
+		return Article{}, err
+	}
+	return p.ParseFile(ctx, path)
+}
+
+// localImagePath 本地html中 img 的 src 为相对路径（如 ./标题_files/640.jpeg）时，返回对应的本地文件
+func (p *parser) localImagePath(img *goquery.Selection) string {
+	if p.baseDir == "" {
+		return ""
+	}
+	src, _ := img.Attr("src")
+	if src == "" || strings.HasPrefix(src, "data:") || strings.Contains(src, "://") || strings.HasPrefix(src, "//") {
+		return ""
+	}
+	if unescaped, err := url.PathUnescape(src); err == nil {
+		src = unescaped
+	}
+	// 去掉可能带有的查询参数
+	if i := strings.IndexAny(src, "?#"); i >= 0 {
+		src = src[:i]
+	}
+	path := filepath.Join(p.baseDir, filepath.FromSlash(src))
+	if info, err := os.Stat(path); err != nil || info.IsDir() || !isWithinDir(p.baseDir, path) {
+		return ""
+	}
+	return path
+}
+
+// isWithinDir path（解析符号链接后）是否在 dir 之内。
+// 收到的html中 src="../../.ssh/id_rsa" 之类的图片不能读取，否则任意本地文件都会被编码进输出
+func isWithinDir(dir string, path string) bool {
+	realDir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return false
+	}
+	realPath, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(realDir, realPath)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// readLocalImage 读取本地图片文件
+func readLocalImage(imgURL string, path string) (*FetchResponse, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return &FetchResponse{URL: imgURL, Body: content}, nil
+}
+
+// resourceKey MHTML、WARC 中资源的key：host + path，
+// 公众号图片路径末尾的尺寸（/640、/0 等）会被去掉，使不同尺寸的地址都能对应到同一张图片
+func resourceKey(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return rawURL
+	}
+	host := strings.ToLower(u.Host)
+	path := u.Path
+	if strings.HasSuffix(host, "mmbiz.qpic.cn") {
+		path = mmbizSizeSuffix.ReplaceAllString(path, "")
+	}
+	return host + path
+}
+
+func (p *parser) addResource(rawURL string, res *FetchResponse) {
+	if rawURL == "" {
+		return
+	}
+	if p.resources == nil {
+		p.resources = make(map[string]*FetchResponse)
+	}
+	key := resourceKey(rawURL)
+	if _, ok := p.resources[key]; !ok {
+		p.resources[key] = res
+	}
+}
+
+// resource 查找内嵌的资源
+func (p *parser) resource(rawURL string) (*FetchResponse, bool) {
+	if p.resources == nil {
+		return nil, false
+	}
+	res, ok := p.resources[resourceKey(rawURL)]
+	return res, ok
+}
+
+// isOffline 图片可以从本地文件或内嵌资源中读取，不需要请求网络
+func (p *parser) isOffline(src string) bool {
+	if _, ok := p.localImages[src]; ok {
+		return true
+	}
+	_, ok := p.resource(src)
+	return ok
+}
@@ -0,0 +1,123 @@
+package parse
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// writeFiles 在 dir 下写入文件，自动创建目录
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestParseFileLocalImages(t *testing.T) {
+	root := t.TempDir()
+	page := `<html><body><div id="img-content"><h1 id="activity-name">本地文章</h1><div id="js_content">
+<p><img data-src="https://example.com/local.jpeg" src="./本地文章_files/640.jpeg"></p>
+<p><img data-src="https://example.com/escaped.png" src="%E6%9C%AC%E5%9C%B0%E6%96%87%E7%AB%A0_files/a%20b.png?v=1"></p>
+<p><img data-src="https://example.com/missing.png" src="./本地文章_files/missing.png"></p>
+<p><img data-src="https://example.com/outside.png" src="../secret.txt"></p>
+<p><img data-src="https://example.com/absolute.png" src="` + filepath.ToSlash(filepath.Join(root, "secret.txt")) + `"></p>
+<p><img data-src="https://example.com/dir.png" src="./本地文章_files"></p>
+<p><img data-src="https://example.com/link.png" src="./本地文章_files/link.png"></p>
+</div></div></body></html>`
+	writeFiles(t, root, map[string]string{
+		"secret.txt":                "secret",
+		"page/本地文章.html":            page,
+		"page/本地文章_files/640.jpeg":  "local-jpeg",
+		"page/本地文章_files/a b.png":   "local-png",
+		"page/本地文章_files/other.png": "other",
+	})
+	hasLink := os.Symlink(filepath.Join(root, "secret.txt"), filepath.Join(root, "page", "本地文章_files", "link.png")) == nil
+
+	var mu sync.Mutex
+	var requests []string
+	fetcher := FetcherFunc(func(ctx context.Context, req *FetchRequest) (*FetchResponse, error) {
+		mu.Lock()
+		requests = append(requests, req.URL)
+		mu.Unlock()
+		return &FetchResponse{URL: req.URL, Body: []byte("remote")}, nil
+	})
+	article, err := ParseFile(context.Background(), filepath.Join(root, "page", "本地文章.html"), Options{ImagePolicy: IMAGE_POLICY_BASE64, Fetcher: fetcher})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"https://example.com/local.jpeg":  "local-jpeg",
+		"https://example.com/escaped.png": "local-png",
+		"https://example.com/missing.png": "remote",
+		"https://example.com/outside.png": "remote",
+		"https://example.com/dir.png":     "remote",
+	}
+	if hasLink {
+		want["https://example.com/link.png"] = "remote"
+	}
+	images := archiveImages(article)
+	for src, content := range want {
+		if images[src] != content {
+			t.Errorf("image %s = %q, want %q", src, images[src], content)
+		}
+	}
+	for _, src := range requests {
+		if src == "https://example.com/local.jpeg" || src == "https://example.com/escaped.png" {
+			t.Errorf("local image %s was downloaded", src)
+		}
+	}
+	for src, content := range images {
+		if content == "secret" {
+			t.Errorf("image %s read a file outside the page directory", src)
+		}
+	}
+}
+
+func TestIsWithinDir(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"secret.txt":         "secret",
+		"page/a_files/1.png": "1",
+		"page/a.html":        "",
+		"page-other/2.png":   "2",
+	})
+	dir := filepath.Join(root, "page")
+	type withinDirCase struct {
+		name string
+		path string
+		want bool
+	}
+	tests := []withinDirCase{
+		{"file in subdir", filepath.Join(dir, "a_files", "1.png"), true},
+		{"file in dir", filepath.Join(dir, "a.html"), true},
+		{"dir itself", dir, true},
+		{"parent", root, false},
+		{"file in parent", filepath.Join(root, "secret.txt"), false},
+		{"dot dot in path", filepath.Join(dir, "a_files") + string(filepath.Separator) + filepath.Join("..", "..", "secret.txt"), false},
+		{"sibling with same prefix", filepath.Join(root, "page-other", "2.png"), false},
+		{"missing file", filepath.Join(dir, "missing.png"), false},
+	}
+	if err := os.Symlink(filepath.Join(root, "secret.txt"), filepath.Join(dir, "a_files", "link.png")); err == nil {
+		tests = append(tests, withinDirCase{"symlink out of dir", filepath.Join(dir, "a_files", "link.png"), false})
+	}
+	if err := os.Symlink(filepath.Join(dir, "a_files", "1.png"), filepath.Join(dir, "inner.png")); err == nil {
+		tests = append(tests, withinDirCase{"symlink within dir", filepath.Join(dir, "inner.png"), true})
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isWithinDir(dir, tt.path); got != tt.want {
+				t.Errorf("isWithinDir(%s) = %v, want %v", strings.TrimPrefix(tt.path, root), got, tt.want)
+			}
+		})
+	}
+}
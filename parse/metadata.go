@@ -0,0 +1,89 @@
+package parse
+
+import (
+	"html"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// 文章页面js中的变量，如 var msg_desc = htmlDecode("...");
+var (
+	scriptMsgLinkReg = regexp.MustCompile(`var\s+msg_link\s*=\s*(?:htmlDecode\()?"([^"]*)"`)
+	scriptCoverReg   = regexp.MustCompile(`var\s+msg_cdn_url\s*=\s*(?:htmlDecode\()?"([^"]*)"`)
+	scriptDescReg    = regexp.MustCompile(`var\s+msg_desc\s*=\s*(?:htmlDecode\()?"([^"]*)"`)
+)
+
+// js字符串中常见的转义
+var scriptUnescaper = strings.NewReplacer(`\x26`, "&", `\x0a`, "\n", `\/`, "/", `\"`, `"`)
+
+// parseMetadata 解析作者、封面、摘要、短链接和话题等元数据
+func parseMetadata(doc *goquery.Document, mainContent *goquery.Selection, article *Article) {
+	script := doc.Find("script").Text()
+	find := func(reg *regexp.Regexp) string {
+		if m := reg.FindStringSubmatch(script); len(m) > 1 {
+			return strings.TrimSpace(html.UnescapeString(html.UnescapeString(scriptUnescaper.Replace(m[1]))))
+		}
+		return ""
+	}
+	metaContent := func(selector string) string {
+		content, _ := doc.Find(selector).Attr("content")
+		return strings.TrimSpace(content)
+	}
+
+	article.Author = removeBrAndBlank(mainContent.Find("#js_author_name").Text())
+	if article.Author == "" {
+		article.Author = metaContent(`meta[name="author"]`)
+	}
+	if article.Cover = metaContent(`meta[property="og:image"]`); article.Cover == "" {
+		article.Cover = find(scriptCoverReg)
+	}
+	if article.Digest = metaContent(`meta[property="og:description"]`); article.Digest == "" {
+		article.Digest = find(scriptDescReg)
+	}
+	for _, link := range []string{article.URL, metaContent(`meta[property="og:url"]`), find(scriptMsgLinkReg)} {
+		if isShortURL(link) {
+			article.ShortURL = link
+			break
+		}
+	}
+	mainContent.Find("#js_tags .article-tag__item").Each(func(i int, sc *goquery.Selection) {
+		if tag := strings.TrimPrefix(removeBrAndBlank(sc.Text()), "#"); tag != "" {
+			article.TagList = append(article.TagList, tag)
+		}
+	})
+}
+
+// isShortURL 形如 https://mp.weixin.qq.com/s/xxxx 的文章短链接
+func isShortURL(link string) bool {
+	u, err := url.Parse(link)
+	if err != nil || u.Host != "mp.weixin.qq.com" {
+		return false
+	}
+	id := strings.TrimPrefix(u.Path, "/s/")
+	return id != u.Path && id != "" && !strings.Contains(id, "/")
+}
+
+// countWords 统计字数：每个汉字（及其它CJK字符）算一个字，连续的字母、数字算一个词
+func countWords(text string) int {
+	count := 0
+	inWord := false
+	for _, r := range text {
+		switch {
+		case unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) || unicode.Is(unicode.Katakana, r) || unicode.Is(unicode.Hangul, r):
+			count++
+			inWord = false
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if !inWord {
+				count++
+			}
+			inWord = true
+		default:
+			inWord = false
+		}
+	}
+	return count
+}
@@ -0,0 +1,82 @@
+package parse
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/http"
+	"net/textproto"
+	"strings"
+)
+
+// ParseMHTML 解析 MHTML 文件（Chrome “网页，单个文件”另存为的 .mhtml），
+// 正文中的图片从文件内嵌的资源中读取，不再请求网络
+func (ps *Parser) ParseMHTML(ctx context.Context, r io.Reader) (Article, error) {
+	tp := textproto.NewReader(bufio.NewReader(r))
+	header, err := tp.ReadMIMEHeader()
+	if err != nil {
+		return Article{}, fmt.Errorf("read mhtml header error: %w", err)
+	}
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		return Article{}, fmt.Errorf("parse mhtml content type error: %w", err)
+	}
+	if !strings.HasPrefix(mediaType, "multipart/") || params["boundary"] == "" {
+		return Article{}, fmt.Errorf("unsupported mhtml content type: %s", mediaType)
+	}
+
+	p := ps.newParser(ctx)
+	p.pageURL = header.Get("Snapshot-Content-Location")
+	var page []byte
+	mr := multipart.NewReader(tp.R, params["boundary"])
+	for {
+		part, err := mr.NextRawPart()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return Article{}, fmt.Errorf("read mhtml part error: %w", err)
+		}
+		body, err := io.ReadAll(decodeTransfer(part, part.Header.Get("Content-Transfer-Encoding")))
+		if err != nil {
+			return Article{}, fmt.Errorf("read mhtml part error: %w", err)
+		}
+		contentType := part.Header.Get("Content-Type")
+		location := part.Header.Get("Content-Location")
+		// 第一个html部分是文章本身，其余的是网页引用的资源
+		if page == nil && strings.HasPrefix(contentType, "text/html") {
+			page = body
+			if p.pageURL == "" {
+				p.pageURL = location
+			}
+			continue
+		}
+		res := &FetchResponse{URL: location, Header: http.Header{"Content-Type": {contentType}}, Body: body}
+		p.addResource(location, res)
+		if cid := strings.Trim(part.Header.Get("Content-ID"), "<>"); cid != "" {
+			p.addResource("cid:"+cid, res)
+		}
+	}
+	if page == nil {
+		return Article{}, errors.New("no html document in mhtml")
+	}
+	return p.parseDocument(bytes.NewReader(page))
+}
+
+// decodeTransfer 按 Content-Transfer-Encoding 解码
+func decodeTransfer(r io.Reader, encoding string) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		// base64.NewDecoder 会忽略其中的换行
+		return base64.NewDecoder(base64.StdEncoding, r)
+	case "quoted-printable":
+		return quotedprintable.NewReader(r)
+	}
+	return r
+}
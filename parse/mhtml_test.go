@@ -0,0 +1,141 @@
+package parse
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"mime/quotedprintable"
+	"strings"
+	"testing"
+)
+
+const mhtmlTestBoundary = "----MultipartBoundary--test"
+
+// mhtmlPart MHTML 中的一个部分，body 按 encoding 编码
+type mhtmlPart struct {
+	contentType string
+	location    string
+	contentID   string
+	encoding    string
+	body        string
+}
+
+// buildMHTML 生成 Chrome 另存为格式的 MHTML
+func buildMHTML(t *testing.T, contentType string, parts ...mhtmlPart) string {
+	t.Helper()
+	var sb strings.Builder
+	sb.WriteString("From: <Saved by Blink>\r\n")
+	sb.WriteString("Snapshot-Content-Location: https://mp.weixin.qq.com/s/mhtml\r\n")
+	sb.WriteString("MIME-Version: 1.0\r\n")
+	sb.WriteString("Content-Type: " + contentType + "\r\n\r\n")
+	for _, part := range parts {
+		sb.WriteString("--" + mhtmlTestBoundary + "\r\n")
+		sb.WriteString("Content-Type: " + part.contentType + "\r\n")
+		if part.contentID != "" {
+			sb.WriteString("Content-ID: <" + part.contentID + ">\r\n")
+		}
+		sb.WriteString("Content-Transfer-Encoding: " + part.encoding + "\r\n")
+		sb.WriteString("Content-Location: " + part.location + "\r\n\r\n")
+		switch part.encoding {
+		case "base64":
+			encoded := base64.StdEncoding.EncodeToString([]byte(part.body))
+			// 与 Chrome 一样每 76 个字符换行
+			for len(encoded) > 76 {
+				sb.WriteString(encoded[:76] + "\r\n")
+				encoded = encoded[76:]
+			}
+			sb.WriteString(encoded + "\r\n")
+		case "quoted-printable":
+			var buf bytes.Buffer
+			qw := quotedprintable.NewWriter(&buf)
+			if _, err := qw.Write([]byte(part.body)); err != nil {
+				t.Fatal(err)
+			}
+			qw.Close()
+			sb.WriteString(buf.String() + "\r\n")
+		default:
+			sb.WriteString(part.body + "\r\n")
+		}
+	}
+	sb.WriteString("--" + mhtmlTestBoundary + "--\r\n")
+	return sb.String()
+}
+
+func TestParseMHTML(t *testing.T) {
+	multipart := `multipart/related; type="text/html"; boundary="` + mhtmlTestBoundary + `"`
+	page := `<html><body><div id="img-content">
+<h1 id="activity-name">单个文件</h1>
+<div id="js_content">
+<p>正文 = 等号</p>
+<p><img data-src="https://mmbiz.qpic.cn/mmbiz_jpg/a/640?wx_fmt=jpeg"></p>
+<p><img src="cid:image-b@mhtml.blink"></p>
+</div></div></body></html>`
+	pagePart := mhtmlPart{contentType: "text/html", location: "https://mp.weixin.qq.com/s/mhtml", encoding: "quoted-printable", body: page}
+	imageA := mhtmlPart{contentType: "image/jpeg", location: "https://mmbiz.qpic.cn/mmbiz_jpg/a/0?wx_fmt=jpeg", encoding: "base64", body: strings.Repeat("image-a", 30)}
+	imageB := mhtmlPart{contentType: "image/png", location: "https://example.com/b.png", contentID: "image-b@mhtml.blink", encoding: "base64", body: "image-b"}
+	css := mhtmlPart{contentType: "text/css", location: "cid:css@mhtml.blink", encoding: "quoted-printable", body: "body { color: red; }"}
+
+	tests := []struct {
+		name       string
+		data       string
+		wantErr    string
+		wantImages map[string]string
+	}{
+		{
+			name: "page and images",
+			data: buildMHTML(t, multipart, pagePart, css, imageA, imageB),
+			wantImages: map[string]string{
+				"https://mmbiz.qpic.cn/mmbiz_jpg/a/0?wx_fmt=jpeg": strings.Repeat("image-a", 30),
+				"cid:image-b@mhtml.blink":                         "image-b",
+			},
+		},
+		{
+			name:    "no html part",
+			data:    buildMHTML(t, multipart, imageA),
+			wantErr: "no html document in mhtml",
+		},
+		{
+			name:    "not multipart",
+			data:    buildMHTML(t, "text/html", pagePart),
+			wantErr: "unsupported mhtml content type",
+		},
+		{
+			name:    "no boundary",
+			data:    buildMHTML(t, "multipart/related", pagePart),
+			wantErr: "unsupported mhtml content type",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := NewParser(Options{ImagePolicy: IMAGE_POLICY_BASE64, Fetcher: offlineFetcher(t)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			article, err := p.ParseMHTML(context.Background(), strings.NewReader(tt.data))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if title := article.Title.Val; title != "单个文件" {
+				t.Errorf("title = %q", title)
+			}
+			if !strings.Contains(article.ToString(), "正文 = 等号") {
+				t.Errorf("quoted-printable page not decoded: %q", article.ToString())
+			}
+			images := archiveImages(article)
+			for src, want := range tt.wantImages {
+				if images[src] != want {
+					t.Errorf("image %s = %q, want %q", src, images[src], want)
+				}
+			}
+			if len(article.FailedImages) != 0 {
+				t.Errorf("failed images = %v", article.FailedImages)
+			}
+		})
+	}
+}
@@ -3,13 +3,38 @@ package parse
 import (
 	"strconv"
 	"strings"
+	"time"
 )
 
 type Article struct {
-	Title   Piece
-	Meta    []string
-	Tags    string
+	// URL 文章的url，从html中解析时取自 og:url
+	URL string
+	// ID 文章的唯一标识
+	ID ArticleID
+	// ContentHash 正文的摘要，正文或图片有修改时会变化
+	ContentHash string
+	Title       Piece
+	// Account 公众号名称
+	Account string
+	// PublishTime 发布时间，页面中没有时为零值
+	PublishTime time.Time
+	// Author 作者
+	Author string
+	// ShortURL 文章的短链接，形如 https://mp.weixin.qq.com/s/xxxx，无法得到时为空
+	ShortURL string
+	// Cover 封面图片的url
+	Cover string
+	// Digest 摘要
+	Digest string
+	// WordCount 正文字数
+	WordCount int
+	Meta      []string
+	Tags      string
+	// TagList 文章所属的话题，不含 #
+	TagList []string
 	Content []Piece
+	// FailedImages 最终下载失败的图片，非空时输出的markdown是不完整的
+	FailedImages []ImageError
 }
 
 func (article Article) ToString() string {
@@ -54,21 +79,24 @@ type Piece struct {
 type PieceType int32
 
 const (
-	HEADER           PieceType = iota // 0  标题
-	LINK                              // 1  链接
-	NORMAL_TEXT                       // 2  文字
-	BOLD_TEXT                         // 3  粗体文字
-	ITALIC_TEXT                       // 4  斜体文字
-	BOLD_ITALIC_TEXT                  // 5  粗斜体
-	IMAGE                             // 6  图片
-	IMAGE_BASE64                      // 7  图片 base64
-	TABLE                             // 8  表格
-	CODE_INLINE                       // 9  代码 内联
-	CODE_BLOCK                        // 10  代码 块
-	BLOCK_QUOTES                      // 11 引用
-	O_LIST                            // 12 有序列表
-	U_LIST                            // 13 无序列表
-	HR                                // 14 分隔线
-	BR                                // 15 换行
-	NULL                              // 无
+	HEADER             PieceType = iota // 0  标题
+	LINK                                // 1  链接
+	NORMAL_TEXT                         // 2  文字
+	BOLD_TEXT                           // 3  粗体文字
+	ITALIC_TEXT                         // 4  斜体文字
+	BOLD_ITALIC_TEXT                    // 5  粗斜体
+	IMAGE                               // 6  图片
+	IMAGE_BASE64                        // 7  图片 base64
+	TABLE                               // 8  表格
+	CODE_INLINE                         // 9  代码 内联
+	CODE_BLOCK                          // 10  代码 块
+	BLOCK_QUOTES                        // 11 引用
+	O_LIST                              // 12 有序列表
+	U_LIST                              // 13 无序列表
+	HR                                  // 14 分隔线
+	BR                                  // 15 换行
+	NULL                                // 16 无
+	STRIKETHROUGH_TEXT                  // 17 删除线
+	UNDERLINE_TEXT                      // 18 下划线
+	HIGHLIGHT_TEXT                      // 19 高亮（背景色）
 )
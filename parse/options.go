@@ -0,0 +1,61 @@
+package parse
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// Options 解析选项，新增的配置项都放在这里，而不是再增加一组函数
+type Options struct {
+	// ImagePolicy 文章内图片的处理方式
+	ImagePolicy ImagePolicy
+	// ImageQuality 微信图片的请求方式，默认保持原图格式
+	ImageQuality ImageQuality
+	// Fetcher 获取页面和图片的实现，为空时使用 NewHTTPFetcher(Proxy)
+	Fetcher Fetcher
+	// Proxy 代理服务器地址，格式为 ip:port，为空则不使用代理；设置了 Fetcher 时忽略
+	Proxy string
+	// HeaderProfile 页面和图片请求共用的浏览器请求头
+	HeaderProfile HeaderProfile
+	// Header 附加到每个请求上的请求头，会覆盖 HeaderProfile 中同名的请求头
+	Header http.Header
+	// HotlinkDetector 判断下载到的图片是否为防盗链占位图，为空时使用 DefaultHotlinkDetector
+	HotlinkDetector func(req *FetchRequest, res *FetchResponse) bool
+	// ProbeHotlink 解析时用外站 Referer 额外请求两张不同的公众号图片，探测以图片形式返回的防盗链占位图，默认不探测
+	ProbeHotlink bool
+	// HotlinkPlaceholderDigests 已知的防盗链占位图的md5，下载到的图片命中时视为失败
+	HotlinkPlaceholderDigests []string
+	// Timeout 单次请求（页面或图片）的超时时间，为 0 时使用默认的 30s
+	Timeout time.Duration
+	// Retry 请求失败时的重试策略
+	Retry RetryPolicy
+	// Headings 正文中标题的识别方式
+	Headings HeadingOptions
+	// Limits 资源限制
+	Limits Limits
+	// Hooks 解析过程中的回调
+	Hooks Hooks
+}
+
+// Limits 资源限制，值为 0 表示不限制
+type Limits struct {
+	// MaxPageBytes 文章页面的最大字节数
+	MaxPageBytes int64
+	// MaxImageBytes 单张图片的最大字节数，超过的图片不保存
+	MaxImageBytes int64
+	// MaxImages 最多下载的图片数量（相同url只算一次），超过的图片不保存
+	MaxImages int
+	// MaxConcurrentImages 同时下载的图片数量，为 0 时默认为 4
+	MaxConcurrentImages int
+	// PerHostRate 对同一个host每秒最多发起的图片请求数
+	PerHostRate float64
+}
+
+// Hooks 解析过程中的回调，均可为空
+type Hooks struct {
+	// BeforeContent 标题、meta等解析完成后、解析正文（下载图片）前调用，返回错误则中止解析
+	BeforeContent func(ctx context.Context, article *Article) error
+	// AfterImage 每张图片下载成功后调用，图片是并发下载的，回调可能被同时调用
+	AfterImage func(src string, res *FetchResponse)
+}
@@ -1,14 +1,11 @@
 package parse
 
 import (
-	"bytes"
+	"context"
 	"encoding/base64"
 	"io"
 	"log"
-	"net"
-	"net/http"
 	"net/url"
-	"os"
 	"regexp"
 	"strconv"
 	"strings"
@@ -17,11 +14,7 @@ import (
 	"github.com/PuerkitoBio/goquery"
 )
 
-func parseSection(s *goquery.Selection, imagePolicy ImagePolicy, lastPieceType PieceType) []Piece {
-	return parseSectionWithProxy(s, imagePolicy, lastPieceType, "")
-}
-
-func parseSectionWithProxy(s *goquery.Selection, imagePolicy ImagePolicy, lastPieceType PieceType, proxy string) []Piece {
+func (p *parser) parseSection(s *goquery.Selection, lastPieceType PieceType) []Piece {
 	var pieces []Piece
 	if lastPieceType == O_LIST || lastPieceType == U_LIST || lastPieceType == NULL || lastPieceType == BLOCK_QUOTES {
 		// pieces = append(pieces, Piece{NULL, nil, nil})
@@ -29,65 +22,75 @@ func parseSectionWithProxy(s *goquery.Selection, imagePolicy ImagePolicy, lastPi
 		pieces = append(pieces, Piece{BR, nil, nil})
 	}
 	var _lastPieceType PieceType = NULL
-	s.Contents().Each(func(i int, sc *goquery.Selection) {
-		attr := make(map[string]string)
+	// number 上一个段落为单独的编号（如 “01”）时，编号的文字及段落在 pieces 中的起始位置
+	var number *standaloneNumber
+	s.Contents().EachWithBreak(func(i int, sc *goquery.Selection) bool {
+		// 请求被取消或超时，停止解析
+		if p.ctx.Err() != nil {
+			return false
+		}
+		prevNumber := number
+		number = nil
+		if goquery.NodeName(sc) == "#text" && strings.TrimSpace(sc.Text()) == "" {
+			number = prevNumber
+		}
 		if sc.Is("a") {
-			attr["href"], _ = sc.Attr("href")
-			pieces = append(pieces, Piece{LINK, removeBrAndBlank(sc.Text()), attr})
+			pieces = append(pieces, p.parseLink(sc)...)
+		} else if isDivider(sc) {
+			// 装饰用的分隔线图片或色块
+			pieces = append(pieces, Piece{HR, nil, nil})
 		} else if sc.Is("img") {
-			// 优化图片处理，支持微信公众号的图片格式
-			src, _ := sc.Attr("data-src")
-			if src == "" {
-				src, _ = sc.Attr("src")
-			}
-			attr["src"] = src
-			attr["alt"], _ = sc.Attr("alt")
-			attr["title"], _ = sc.Attr("title")
-			
-			// 处理微信公众号的图片水印和格式
-			if strings.Contains(src, "mmbiz.qpic.cn") {
-				// 移除微信图片的压缩参数，获取原图
-				if strings.Contains(src, "wx_fmt=") {
-					src = strings.Split(src, "&wx_fmt=")[0] + "&wx_fmt=jpeg"
-				}
-				attr["src"] = src
-			}
-			
-			switch imagePolicy {
-			case IMAGE_POLICY_URL:
-				pieces = append(pieces, Piece{IMAGE, nil, attr})
-			case IMAGE_POLICY_SAVE:
-				image := fetchImgFileWithProxy(attr["src"], proxy)
-				pieces = append(pieces, Piece{IMAGE, image, attr})
-			case IMAGE_POLICY_BASE64:
-				fallthrough
-			default:
-				base64Image := img2base64(fetchImgFileWithProxy(attr["src"], proxy))
-				pieces = append(pieces, Piece{IMAGE_BASE64, base64Image, attr})
-			}
+			pieces = append(pieces, p.parseImage(sc))
 		} else if sc.Is("ol") {
-			pieces = append(pieces, parseListWithProxy(sc, O_LIST, imagePolicy, proxy)...)
+			pieces = append(pieces, p.parseList(sc, O_LIST)...)
 		} else if sc.Is("ul") {
-			pieces = append(pieces, parseListWithProxy(sc, U_LIST, imagePolicy, proxy)...)
+			pieces = append(pieces, p.parseList(sc, U_LIST)...)
+		} else if sc.Is("code") && isInlineCode(sc) {
+			// 段落中的行内代码，与 parseInline 一样去掉首尾的空白
+			if code := strings.TrimSpace(sc.Text()); code != "" {
+				pieces = append(pieces, Piece{CODE_INLINE, code, nil})
+			}
 		} else if sc.Is("pre") || sc.Is("section.code-snippet__fix") || sc.Is("code") {
 			// 代码块
 			pieces = append(pieces, parsePre(sc)...)
+		} else if styles := inlineStyles(sc); len(styles) > 0 {
+			// 用样式表示的粗体、高亮等，如 <span style="font-weight: bold">
+			pieces = append(pieces, p.parseStyled(sc, styles)...)
+		} else if sc.Is("span") && sc.Find(blockSelector).Length() == 0 {
+			// 行内的 span 不另起一行
+			pieces = append(pieces, p.parseSection(sc, NULL)...)
 		} else if sc.Is("span") || sc.Is("figure") {
-			pieces = append(pieces, parseSectionWithProxy(sc, imagePolicy, _lastPieceType, proxy)...)
+			pieces = append(pieces, p.parseSection(sc, _lastPieceType)...)
 		} else if sc.Is("p") || sc.Is("section") || sc.Is("figcaption") {
-			pieces = append(pieces, parseSectionWithProxy(sc, imagePolicy, _lastPieceType, proxy)...)
+			start := len(pieces)
+			pieces = append(pieces, p.parseSection(sc, _lastPieceType)...)
 			if removeBrAndBlank(sc.Text()) != "" && len(pieces) > 0 && pieces[len(pieces)-1].Type != BR {
 				pieces = append(pieces, Piece{BR, nil, nil})
 			}
+			// 用字号、粗体等样式表示的标题，上一段是单独的编号时与编号合并
+			prefix, headingStart := "", start
+			if prevNumber != nil {
+				prefix, headingStart = prevNumber.text, prevNumber.start
+			}
+			text := removeBrAndBlank(sc.Text())
+			if header, ok := p.inferHeading(sc, prefix, append([]Piece(nil), pieces[headingStart:]...)); ok {
+				pieces = pieces[:headingStart]
+				if ptype := lastBlockType(pieces); ptype != NULL && ptype != BR {
+					pieces = append(pieces, Piece{BR, nil, nil})
+				}
+				pieces = append(pieces, header)
+			} else if standaloneNumberReg.MatchString(text) {
+				number = &standaloneNumber{text: text, start: start}
+			}
 		} else if sc.Is("h1") || sc.Is("h2") || sc.Is("h3") || sc.Is("h4") || sc.Is("h5") || sc.Is("h6") {
 			pieces = append(pieces, parseHeader(sc)...)
 		} else if sc.Is("blockquote") {
-			pieces = append(pieces, parseBlockQuoteWithProxy(sc, imagePolicy, proxy)...)
+			pieces = append(pieces, p.parseBlockQuote(sc)...)
 		} else if sc.Is("strong") || sc.Is("b") {
-			pieces = append(pieces, parseStrong(sc)...)
+			pieces = append(pieces, p.parseEmphasis(sc, BOLD_TEXT)...)
 		} else if sc.Is("em") || sc.Is("i") {
 			// 处理斜体文本
-			pieces = append(pieces, Piece{ITALIC_TEXT, removeBrAndBlank(sc.Text()), nil})
+			pieces = append(pieces, p.parseEmphasis(sc, ITALIC_TEXT)...)
 		} else if sc.Is("table") {
 			pieces = append(pieces, parseTable(sc)...)
 		} else if sc.Is("hr") {
@@ -119,20 +122,31 @@ func parseSectionWithProxy(s *goquery.Selection, imagePolicy ImagePolicy, lastPi
 				cardTitle, _ := sc.Attr("data-title")
 				pieces = append(pieces, Piece{NORMAL_TEXT, "[卡片: " + cardTitle + "]", nil})
 			} else if sc.Text() != "" {
-				// 处理普通文本，优化空白字符处理
-				text := removeBrAndBlank(sc.Text())
+				// 处理普通文本，保留与相邻行内元素之间的空格，行首行尾的空格由 trimLineSpaces 去掉
+				text := collapseBlank(sc.Text())
 				if text != "" {
 					pieces = append(pieces, Piece{NORMAL_TEXT, text, nil})
 				}
 			}
 		}
-		if len(pieces) > 0 {
-			_lastPieceType = pieces[len(pieces)-1].Type
+		if ptype := lastBlockType(pieces); ptype != NULL {
+			_lastPieceType = ptype
 		}
+		return true
 	})
 	return pieces
 }
 
+// lastBlockType 最后一个不是空白文字的 piece 的类型，块之间只有空白的文字不算，没有时返回 NULL
+func lastBlockType(pieces []Piece) PieceType {
+	for i := len(pieces) - 1; i >= 0; i-- {
+		if pieces[i].Type != NORMAL_TEXT || strings.TrimSpace(pieces[i].Val.(string)) != "" {
+			return pieces[i].Type
+		}
+	}
+	return NULL
+}
+
 func parseHeader(s *goquery.Selection) []Piece {
 	var level int
 	switch {
@@ -154,70 +168,93 @@ func parseHeader(s *goquery.Selection) []Piece {
 	return []Piece{p}
 }
 
-func parsePre(s *goquery.Selection) []Piece {
-	// 优化代码块解析，支持更多代码格式
-	var codeRows []string
-	
-	// 处理 <pre><code> 结构
-	s.Find("code").Each(func(i int, sc *goquery.Selection) {
-		var codeLine string = ""
-		sc.Contents().Each(func(i int, sc *goquery.Selection) {
-			if goquery.NodeName(sc) == "br" {
-				codeRows = append(codeRows, codeLine)
-				codeLine = ""
-			} else {
-				codeLine += sc.Text()
-			}
-		})
-		codeRows = append(codeRows, codeLine)
-	})
-	
-	// 如果没有找到 code 标签，直接处理 pre 标签内容
-	if len(codeRows) == 0 {
-		var codeLine string = ""
-		s.Contents().Each(func(i int, sc *goquery.Selection) {
-			if goquery.NodeName(sc) == "br" {
-				codeRows = append(codeRows, codeLine)
-				codeLine = ""
-			} else {
-				codeLine += sc.Text()
-			}
-		})
-		codeRows = append(codeRows, codeLine)
-	}
-	
-	// 清理空行
-	var cleanedRows []string
-	for _, row := range codeRows {
-		if strings.TrimSpace(row) != "" {
-			cleanedRows = append(cleanedRows, row)
+// isInlineCode 不在 pre 中、不换行的 code 为行内代码，否则作为代码块
+func isInlineCode(s *goquery.Selection) bool {
+	return s.Closest("pre").Length() == 0 && !strings.Contains(s.Text(), "\n") &&
+		s.Find("br").Length() == 0 && s.Find(blockSelector).Length() == 0
+}
+
+// 高度与宽度之比小于该值的图片视为分隔线
+const dividerImageMaxRatio = 0.05
+
+// isDivider 判断是否为装饰用的分隔线：细长的图片，或者没有内容、只有上/下边框或很矮的色块的 section
+func isDivider(s *goquery.Selection) bool {
+	if s.Is("img") {
+		ratio, err := strconv.ParseFloat(s.AttrOr("data-ratio", ""), 64)
+		return err == nil && ratio > 0 && ratio < dividerImageMaxRatio
+	}
+	if !s.Is("section, p, div") || removeBrAndBlank(s.Text()) != "" || s.Children().Not("br").Length() > 0 {
+		return false
+	}
+	style := parseStyle(s.AttrOr("style", ""))
+	for _, prop := range []string{"border-top", "border-bottom"} {
+		if isBorderLine(style[prop]) {
+			return true
 		}
 	}
-	
-	p := Piece{CODE_BLOCK, cleanedRows, nil}
-	return []Piece{p}
+	height := parseLength(style["height"])
+	return height > 0 && height <= 4 && (isHighlightColor(style["background-color"]) || isHighlightColor(style["background"]))
+}
+
+// isBorderLine 边框的值是否为可见的线，如 1px solid #ccc
+func isBorderLine(border string) bool {
+	if border == "" || strings.Contains(border, "none") || strings.Contains(border, "hidden") {
+		return false
+	}
+	for _, field := range strings.Fields(border) {
+		// 宽度为 0 的边框不可见
+		if field == "0" || strings.HasSuffix(field, "px") && parseLength(field) == 0 {
+			return false
+		}
+	}
+	return strings.Contains(border, "solid") || strings.Contains(border, "dashed") ||
+		strings.Contains(border, "dotted") || strings.Contains(border, "double")
 }
 
-func parseList(s *goquery.Selection, ptype PieceType, imagePolicy ImagePolicy) []Piece {
-	return parseListWithProxy(s, ptype, imagePolicy, "")
+// parsePre 解析代码块，保留代码中的空行，去掉行号，Attrs 中的 lang 为代码的语言
+func parsePre(s *goquery.Selection) []Piece {
+	var text string
+	codes := s.Find("code")
+	if codes.Length() > 1 {
+		// 微信的代码块每行是一个 code
+		var lines []string
+		codes.Each(func(i int, sc *goquery.Selection) {
+			lines = append(lines, strings.TrimSuffix(codeText(sc), "\n"))
+		})
+		text = strings.Join(lines, "\n")
+	} else if codes.Length() == 1 {
+		text = codeText(codes)
+	} else {
+		text = codeText(s)
+	}
+
+	// 去掉首尾的空行，保留中间的空行
+	codeRows := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	for len(codeRows) > 0 && strings.TrimSpace(codeRows[0]) == "" {
+		codeRows = codeRows[1:]
+	}
+	for len(codeRows) > 0 && strings.TrimSpace(codeRows[len(codeRows)-1]) == "" {
+		codeRows = codeRows[:len(codeRows)-1]
+	}
+	codeRows = stripLineNumbers(codeRows)
+
+	attrs := map[string]string{"lang": codeLanguage(s, strings.Join(codeRows, "\n"))}
+	p := Piece{CODE_BLOCK, codeRows, attrs}
+	return []Piece{p}
 }
 
-func parseListWithProxy(s *goquery.Selection, ptype PieceType, imagePolicy ImagePolicy, proxy string) []Piece {
+func (p *parser) parseList(s *goquery.Selection, ptype PieceType) []Piece {
 	var list []Piece
 	s.Find("li").Each(func(i int, sc *goquery.Selection) {
-		list = append(list, Piece{ptype, parseSectionWithProxy(sc, imagePolicy, ptype, proxy), nil})
+		list = append(list, Piece{ptype, p.parseSection(sc, ptype), nil})
 	})
 	return list
 }
 
-func parseBlockQuote(s *goquery.Selection, imagePolicy ImagePolicy) []Piece {
-	return parseBlockQuoteWithProxy(s, imagePolicy, "")
-}
-
-func parseBlockQuoteWithProxy(s *goquery.Selection, imagePolicy ImagePolicy, proxy string) []Piece {
+func (p *parser) parseBlockQuote(s *goquery.Selection) []Piece {
 	var bq []Piece
 	s.Contents().Each(func(i int, sc *goquery.Selection) {
-		bq = append(bq, Piece{BLOCK_QUOTES, parseSectionWithProxy(sc, imagePolicy, BLOCK_QUOTES, proxy), nil})
+		bq = append(bq, Piece{BLOCK_QUOTES, p.parseSection(sc, BLOCK_QUOTES), nil})
 	})
 	bq = append(bq, Piece{BR, nil, nil})
 	return bq
@@ -226,7 +263,7 @@ func parseBlockQuoteWithProxy(s *goquery.Selection, imagePolicy ImagePolicy, pro
 func parseTable(s *goquery.Selection) []Piece {
 	// 优化表格解析，转换为 Markdown 格式
 	var table []Piece
-	
+
 	// 尝试解析表格结构
 	var rows []string
 	s.Find("tr").Each(func(i int, tr *goquery.Selection) {
@@ -239,7 +276,7 @@ func parseTable(s *goquery.Selection) []Piece {
 			rows = append(rows, "| "+strings.Join(cells, " | ")+" |")
 		}
 	})
-	
+
 	if len(rows) > 0 {
 		// 添加表头分隔符
 		if len(rows) > 1 {
@@ -251,7 +288,7 @@ func parseTable(s *goquery.Selection) []Piece {
 			}
 			rows = append([]string{rows[0], separator}, rows[1:]...)
 		}
-		
+
 		tableMd := strings.Join(rows, "\n")
 		table = append(table, Piece{TABLE, tableMd, map[string]string{"type": "markdown"}})
 	} else {
@@ -259,14 +296,304 @@ func parseTable(s *goquery.Selection) []Piece {
 		html, _ := s.Html()
 		table = append(table, Piece{TABLE, "<table>" + html + "</table>", map[string]string{"type": "native"}})
 	}
-	
+
 	return table
 }
 
-func parseStrong(s *goquery.Selection) []Piece {
-	var bt []Piece
-	bt = append(bt, Piece{BOLD_TEXT, strings.TrimSpace(s.Text()), nil})
-	return bt
+func (p *parser) parseImage(s *goquery.Selection) Piece {
+	attr := make(map[string]string)
+	// 优化图片处理，支持微信公众号的图片格式
+	src, _ := s.Attr("data-src")
+	if src == "" {
+		src, _ = s.Attr("src")
+	}
+	attr["src"] = src
+	attr["alt"], _ = s.Attr("alt")
+	attr["title"], _ = s.Attr("title")
+
+	// 处理微信公众号的图片水印和格式
+	if strings.Contains(src, "mmbiz.qpic.cn") {
+		attr["src"] = mmbizImageURL(src, p.opts.ImageQuality)
+	}
+	localPath := p.localImagePath(s)
+
+	switch p.opts.ImagePolicy {
+	case IMAGE_POLICY_URL:
+		return Piece{IMAGE, nil, attr}
+	case IMAGE_POLICY_SAVE:
+		// 图片在正文解析完成后统一下载
+		p.addImage(attr["src"], localPath)
+		return Piece{IMAGE, nil, attr}
+	case IMAGE_POLICY_BASE64:
+		fallthrough
+	default:
+		p.addImage(attr["src"], localPath)
+		return Piece{IMAGE_BASE64, nil, attr}
+	}
+}
+
+// parseLink 链接的 Val 为文字，或包含粗体、图片等行内元素时为 []Piece
+func (p *parser) parseLink(s *goquery.Selection) []Piece {
+	attr := make(map[string]string)
+	attr["href"], _ = s.Attr("href")
+	lead, children, trail := trimEdgeSpaces(p.parseInline(s))
+	if len(children) == 0 {
+		return withEdgeSpaces(lead || trail, nil, false)
+	}
+	return withEdgeSpaces(lead, []Piece{{LINK, inlineValue(children), attr}}, trail)
+}
+
+// parseEmphasis 解析粗体、斜体，ptype 为 BOLD_TEXT 或 ITALIC_TEXT
+func (p *parser) parseEmphasis(s *goquery.Selection, ptype PieceType) []Piece {
+	return wrapInline(p.parseInline(s), ptype)
+}
+
+// parseStyled 按 inlineStyles 得到的样式由内向外包装元素的内容
+func (p *parser) parseStyled(s *goquery.Selection, styles []PieceType) []Piece {
+	pieces := p.parseInline(s)
+	for i := len(styles) - 1; i >= 0; i-- {
+		pieces = wrapInline(pieces, styles[i])
+	}
+	return pieces
+}
+
+// wrapInline 用 ptype 包装行内元素。粗体中只有斜体（或相反）时合并为 BOLD_ITALIC_TEXT；
+// 内容包含链接等行内元素时 Val 为 []Piece
+func wrapInline(children []Piece, ptype PieceType) []Piece {
+	// 首尾的空格放到标记之外，否则 ** 等标记紧挨着空格时不会被渲染
+	lead, children, trail := trimEdgeSpaces(children)
+	if len(children) == 0 {
+		return withEdgeSpaces(lead || trail, nil, false)
+	}
+	if len(children) == 1 {
+		child := children[0]
+		switch {
+		case child.Type == ptype:
+			return withEdgeSpaces(lead, children, trail)
+		case ptype != BOLD_TEXT && ptype != ITALIC_TEXT:
+			// 下划线、高亮等不合并
+		case child.Type == BOLD_ITALIC_TEXT:
+			return withEdgeSpaces(lead, children, trail)
+		case child.Type == BOLD_TEXT || child.Type == ITALIC_TEXT:
+			return withEdgeSpaces(lead, []Piece{{BOLD_ITALIC_TEXT, child.Val, nil}}, trail)
+		}
+	}
+	return withEdgeSpaces(lead, []Piece{{ptype, inlineValue(children), nil}}, trail)
+}
+
+// trimEdgeSpaces 去掉首尾文字的空格，返回首、尾是否有空格
+func trimEdgeSpaces(pieces []Piece) (bool, []Piece, bool) {
+	var lead, trail bool
+	pieces = append([]Piece(nil), pieces...)
+	if len(pieces) > 0 && pieces[0].Type == NORMAL_TEXT {
+		text := pieces[0].Val.(string)
+		pieces[0].Val = strings.TrimLeft(text, " ")
+		lead = pieces[0].Val != text
+	}
+	if last := len(pieces) - 1; last >= 0 && pieces[last].Type == NORMAL_TEXT {
+		text := pieces[last].Val.(string)
+		pieces[last].Val = strings.TrimRight(text, " ")
+		trail = pieces[last].Val != text
+	}
+	return lead, mergeInline(pieces), trail
+}
+
+// withEdgeSpaces 在 pieces 前后加上空格
+func withEdgeSpaces(lead bool, pieces []Piece, trail bool) []Piece {
+	if lead {
+		pieces = append([]Piece{{NORMAL_TEXT, " ", nil}}, pieces...)
+	}
+	if trail {
+		pieces = append(pieces, Piece{NORMAL_TEXT, " ", nil})
+	}
+	return pieces
+}
+
+// 表示行内样式的标签
+var styleTags = map[string]PieceType{
+	"u":      UNDERLINE_TEXT,
+	"ins":    UNDERLINE_TEXT,
+	"s":      STRIKETHROUGH_TEXT,
+	"del":    STRIKETHROUGH_TEXT,
+	"strike": STRIKETHROUGH_TEXT,
+	"mark":   HIGHLIGHT_TEXT,
+}
+
+// 包含这些元素的 span 不作为行内元素处理
+const blockSelector = "p, section, div, ul, ol, table, pre, blockquote, h1, h2, h3, h4, h5, h6, figure"
+
+// inlineStyles 根据标签及 style 属性判断行内元素的样式，依次为粗体、斜体、下划线、删除线、高亮。
+// 只处理不包含段落等块级元素的 span、font 及 u、del 等标签
+func inlineStyles(s *goquery.Selection) []PieceType {
+	name := goquery.NodeName(s)
+	tagStyle, isStyleTag := styleTags[name]
+	if !isStyleTag && name != "span" && name != "font" {
+		return nil
+	}
+	if s.Find(blockSelector).Length() > 0 {
+		return nil
+	}
+	style := parseStyle(s.AttrOr("style", ""))
+	var styles []PieceType
+	if isBoldWeight(style["font-weight"]) {
+		styles = append(styles, BOLD_TEXT)
+	}
+	if fontStyle := style["font-style"]; fontStyle == "italic" || fontStyle == "oblique" {
+		styles = append(styles, ITALIC_TEXT)
+	}
+	decoration := style["text-decoration"] + " " + style["text-decoration-line"]
+	if tagStyle == UNDERLINE_TEXT || strings.Contains(decoration, "underline") {
+		styles = append(styles, UNDERLINE_TEXT)
+	}
+	if tagStyle == STRIKETHROUGH_TEXT || strings.Contains(decoration, "line-through") {
+		styles = append(styles, STRIKETHROUGH_TEXT)
+	}
+	if tagStyle == HIGHLIGHT_TEXT || isHighlightColor(style["background-color"]) || isHighlightColor(style["background"]) {
+		styles = append(styles, HIGHLIGHT_TEXT)
+	}
+	return styles
+}
+
+func isBoldWeight(weight string) bool {
+	return weight == "bold" || weight == "bolder" || weight == "600" || weight == "700" || weight == "800" || weight == "900"
+}
+
+// parseStyle 解析 style 属性，属性名和值都转为小写
+func parseStyle(style string) map[string]string {
+	res := make(map[string]string)
+	for _, decl := range strings.Split(style, ";") {
+		name, val, ok := strings.Cut(decl, ":")
+		if !ok {
+			continue
+		}
+		val = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(strings.ToLower(val)), "!important"))
+		res[strings.TrimSpace(strings.ToLower(name))] = val
+	}
+	return res
+}
+
+// 空白、透明及白色等背景色不算高亮
+var noHighlightColors = map[string]bool{
+	"":                    true,
+	"none":                true,
+	"transparent":         true,
+	"inherit":             true,
+	"initial":             true,
+	"unset":               true,
+	"white":               true,
+	"#fff":                true,
+	"#ffffff":             true,
+	"rgb(255,255,255)":    true,
+	"rgba(0,0,0,0)":       true,
+	"rgba(255,255,255,0)": true,
+}
+
+func isHighlightColor(color string) bool {
+	color = strings.ReplaceAll(color, " ", "")
+	if noHighlightColors[color] {
+		return false
+	}
+	// rgba(..., 0) 完全透明
+	if strings.HasPrefix(color, "rgba(") && strings.HasSuffix(color, ",0)") {
+		return false
+	}
+	// background 中不是颜色的值，如图片、渐变
+	return !strings.Contains(color, "url(") && !strings.Contains(color, "gradient(")
+}
+
+// parseInline 解析粗体、链接等行内元素中的内容，文字保留与相邻元素之间的空格，首尾的空格由 wrapInline 移到标记之外
+func (p *parser) parseInline(s *goquery.Selection) []Piece {
+	var pieces []Piece
+	s.Contents().Each(func(i int, sc *goquery.Selection) {
+		switch {
+		case goquery.NodeName(sc) == "#text":
+			if text := collapseBlank(sc.Text()); text != "" {
+				pieces = append(pieces, Piece{NORMAL_TEXT, text, nil})
+			}
+		case sc.Is("strong") || sc.Is("b"):
+			pieces = append(pieces, p.parseEmphasis(sc, BOLD_TEXT)...)
+		case sc.Is("em") || sc.Is("i"):
+			pieces = append(pieces, p.parseEmphasis(sc, ITALIC_TEXT)...)
+		case sc.Is("a"):
+			pieces = append(pieces, p.parseLink(sc)...)
+		case sc.Is("code"):
+			if text := strings.TrimSpace(sc.Text()); text != "" {
+				pieces = append(pieces, Piece{CODE_INLINE, text, nil})
+			}
+		case sc.Is("img"):
+			pieces = append(pieces, p.parseImage(sc))
+		case sc.Is("br"):
+			pieces = append(pieces, Piece{NORMAL_TEXT, " ", nil})
+		default:
+			if styles := inlineStyles(sc); len(styles) > 0 {
+				pieces = append(pieces, p.parseStyled(sc, styles)...)
+			} else {
+				// span 等其它元素只取其中的内容
+				pieces = append(pieces, p.parseInline(sc)...)
+			}
+		}
+	})
+	return mergeInline(pieces)
+}
+
+// mergeInline 合并相邻的文字，去掉空的文字
+func mergeInline(pieces []Piece) []Piece {
+	var res []Piece
+	for _, piece := range pieces {
+		if piece.Type == NORMAL_TEXT && len(res) > 0 && res[len(res)-1].Type == NORMAL_TEXT {
+			res[len(res)-1].Val = collapseBlank(res[len(res)-1].Val.(string) + piece.Val.(string))
+			continue
+		}
+		res = append(res, piece)
+	}
+	trimmed := res[:0]
+	for _, piece := range res {
+		if piece.Type != NORMAL_TEXT || piece.Val.(string) != "" {
+			trimmed = append(trimmed, piece)
+		}
+	}
+	return trimmed
+}
+
+// isInlinePiece 文字、粗体、链接等与相邻内容在同一行的元素
+func isInlinePiece(ptype PieceType) bool {
+	switch ptype {
+	case NORMAL_TEXT, LINK, BOLD_TEXT, ITALIC_TEXT, BOLD_ITALIC_TEXT, CODE_INLINE,
+		STRIKETHROUGH_TEXT, UNDERLINE_TEXT, HIGHLIGHT_TEXT:
+		return true
+	}
+	return false
+}
+
+// trimLineSpaces 合并相邻的文字，去掉行首、行尾（与换行、图片等块级元素相邻）的空格，列表和引用中的内容同样处理
+func trimLineSpaces(pieces []Piece) []Piece {
+	pieces = mergeInline(pieces)
+	for i := range pieces {
+		switch pieces[i].Type {
+		case NORMAL_TEXT:
+			text := pieces[i].Val.(string)
+			if i == 0 || !isInlinePiece(pieces[i-1].Type) {
+				text = strings.TrimLeft(text, " ")
+			}
+			if i == len(pieces)-1 || !isInlinePiece(pieces[i+1].Type) {
+				text = strings.TrimRight(text, " ")
+			}
+			pieces[i].Val = text
+		case O_LIST, U_LIST, BLOCK_QUOTES:
+			if children, ok := pieces[i].Val.([]Piece); ok {
+				pieces[i].Val = trimLineSpaces(children)
+			}
+		}
+	}
+	return mergeInline(pieces)
+}
+
+// inlineValue 行内元素只包含文字时 Val 为 string，否则为 []Piece
+func inlineValue(children []Piece) Value {
+	if len(children) == 1 && children[0].Type == NORMAL_TEXT {
+		return children[0].Val
+	}
+	return children
 }
 
 func parseMeta(s *goquery.Selection) []string {
@@ -290,17 +617,28 @@ func parseMeta(s *goquery.Selection) []string {
 	return res
 }
 
-func ParseFromReader(r io.Reader, imagePolicy ImagePolicy) Article {
-	return ParseFromReaderWithProxy(r, imagePolicy, "")
-}
-
-func ParseFromReaderWithProxy(r io.Reader, imagePolicy ImagePolicy, proxy string) Article {
+func (p *parser) parseDocument(r io.Reader) (Article, error) {
 	var article Article
 	doc, err := goquery.NewDocumentFromReader(r)
 	if err != nil {
-		log.Fatal(err)
+		return article, err
+	}
+	if p.pageURL == "" {
+		// 从html中读取时，用文章自身的url作为图片请求的 Referer
+		p.pageURL, _ = doc.Find(`meta[property="og:url"]`).Attr("content")
 	}
 	var mainContent *goquery.Selection = doc.Find("#img-content")
+	content := mainContent.Find("#js_content")
+	if content.Length() == 0 {
+		if isDeletedPage(doc) {
+			return article, ErrArticleDeleted
+		}
+		return article, ErrNotWechatPage
+	}
+
+	article.URL = p.pageURL
+	article.ID = parseArticleID(doc, p.pageURL)
+	article.ContentHash = contentHash(content)
 
 	// 标题
 	title := mainContent.Find("#activity-name").Text()
@@ -311,180 +649,136 @@ func ParseFromReaderWithProxy(r io.Reader, imagePolicy ImagePolicy, proxy string
 	meta := mainContent.Find("#meta_content")
 	metastring := parseMeta(meta)
 	article.Meta = metastring
+	article.Account = removeBrAndBlank(meta.Find("#js_name").Text())
 	// 从js中找到发布时间
 	re, _ := regexp.Compile("var ct = \"([0-9]+)\"")
 	findstrs := re.FindStringSubmatch(doc.Find("script").Text())
 	if len(findstrs) > 1 {
 		var createTime string = findstrs[1]
 		timestamp, _ := strconv.Atoi(createTime)
-		time := time.Unix(int64(timestamp), 0)
-		article.Meta = append(article.Meta, time.Format("2006-01-02 15:04"))
+		article.PublishTime = time.Unix(int64(timestamp), 0)
+		article.Meta = append(article.Meta, article.PublishTime.Format("2006-01-02 15:04"))
+	} else if publishTime, err := time.ParseInLocation("2006-01-02", removeBrAndBlank(meta.Find("#publish_time").Text()), time.Local); err == nil {
+		article.PublishTime = publishTime
 	}
 
 	// tags 细节待完善
 	tags := mainContent.Find("#js_tags").Text()
 	tags = removeBrAndBlank(tags)
 	article.Tags = tags
+	parseMetadata(doc, mainContent, &article)
+	article.WordCount = countWords(content.Text())
 
 	// content
 	// section[style="line-height: 1.5em;"]>span,a	=> 一般段落（含文本和超链接）
 	// p[style="line-height: 1.5em;"]				=> 项目列表（有序/无序）
 	// section[style=".*text-align:center"]>img		=> 居中段落（图片）
-	content := mainContent.Find("#js_content")
-	pieces := parseSectionWithProxy(content, imagePolicy, NULL, proxy)
+	if p.opts.Hooks.BeforeContent != nil {
+		if err := p.opts.Hooks.BeforeContent(p.ctx, &article); err != nil {
+			return Article{}, err
+		}
+	}
+	pieces := trimLineSpaces(p.assignHeadingLevels(p.parseSection(content, NULL)))
+	article.FailedImages = p.fetchImages()
+	p.attachImages(pieces)
+	if err := p.ctx.Err(); err != nil {
+		return Article{}, err
+	}
 	article.Content = pieces
 
+	return article, nil
+}
+
+// 文章被删除或违规时，微信返回的是一个提示页
+var deletedPageHints = []string{
+	"该内容已被发布者删除",
+	"此内容因违规无法查看",
+	"此内容被多人投诉",
+	"该公众号已迁移",
+}
+
+func isDeletedPage(doc *goquery.Document) bool {
+	text := doc.Find(".weui-msg__title, .weui-msg__desc, .global_error_msg").Text()
+	if text == "" {
+		text = doc.Find("body").Text()
+	}
+	for _, hint := range deletedPageHints {
+		if strings.Contains(text, hint) {
+			return true
+		}
+	}
+	return false
+}
+
+// Deprecated: 使用 ParseReader
+func ParseFromReader(r io.Reader, imagePolicy ImagePolicy) Article {
+	return ParseFromReaderWithProxy(r, imagePolicy, "")
+}
+
+// Deprecated: 使用 ParseReader
+func ParseFromReaderWithProxy(r io.Reader, imagePolicy ImagePolicy, proxy string) Article {
+	article, err := ParseReader(context.Background(), r, Options{ImagePolicy: imagePolicy, Proxy: proxy})
+	if err != nil {
+		log.Printf("parse article error: %s", err.Error())
+	}
 	return article
 }
 
+// Deprecated: 使用 ParseReader
 func ParseFromHTMLString(s string, imagePolicy ImagePolicy) Article {
 	return ParseFromReader(strings.NewReader(s), imagePolicy)
 }
 
+// Deprecated: 使用 ParseFile
 func ParseFromHTMLFile(filepath string, imagePolicy ImagePolicy) Article {
-	file, err := os.Open(filepath)
+	article, err := ParseFile(context.Background(), filepath, Options{ImagePolicy: imagePolicy})
 	if err != nil {
-		panic(err)
+		log.Printf("parse file %s error: %s", filepath, err.Error())
 	}
-	defer file.Close()
-	content, err2 := io.ReadAll(file)
-	if err2 != nil {
-		panic(err)
-	}
-	return ParseFromReader(bytes.NewReader(content), imagePolicy)
+	return article
 }
 
+// Deprecated: 使用 Parse
 func ParseFromURL(url string, imagePolicy ImagePolicy) Article {
 	return ParseFromURLWithProxy(url, imagePolicy, "")
 }
 
+// Deprecated: 使用 Parse
 func ParseFromURLWithProxy(targetURL string, imagePolicy ImagePolicy, proxy string) Article {
-	req, err := http.NewRequest("GET", targetURL, nil)
-
-	if err != nil {
-		log.Printf("new request %s error: %s", targetURL, err.Error())
-		return Article{} // 返回空结果而不是 panic
-	}
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/133.0.0.0 Safari/537.36 Edg/133.0.0.0")
-	
-	// 设置超时
-	client := &http.Client{
-		Timeout: 30 * time.Second,
-	}
-	
-	// 如果提供了代理，设置代理
-	if proxy != "" {
-		proxyURL, err := url.Parse("http://" + proxy)
-		if err != nil {
-			log.Printf("invalid proxy format %s: %s", proxy, err.Error())
-		} else {
-			client.Transport = &http.Transport{
-				Proxy: http.ProxyURL(proxyURL),
-				// 设置连接超时
-				DialContext: (&net.Dialer{
-					Timeout:   30 * time.Second,
-					KeepAlive: 30 * time.Second,
-				}).DialContext,
-				// 设置空闲连接超时
-				IdleConnTimeout:       90 * time.Second,
-				TLSHandshakeTimeout:   30 * time.Second,
-				ResponseHeaderTimeout: 30 * time.Second,
-			}
-		}
-	}
-	
-	res, err := client.Do(req)
+	article, err := Parse(context.Background(), targetURL, Options{ImagePolicy: imagePolicy, Proxy: proxy})
 	if err != nil {
-		log.Printf("request to url %s error: %s", targetURL, err.Error())
+		log.Printf("parse article %s error: %s", targetURL, err.Error())
 		return Article{} // 返回空结果而不是 panic
 	}
-	defer res.Body.Close()
-	if res.StatusCode != 200 {
-		log.Printf("get from url %s error: %d %s", targetURL, res.StatusCode, res.Status)
-		return Article{} // 返回空结果而不是 panic
-	}
-	return ParseFromReaderWithProxy(res.Body, imagePolicy, proxy)
+	return article
 }
 
 func removeBrAndBlank(s string) string {
 	// 优化文本清理，更好地处理微信公众号的文本格式
-	s = strings.TrimSpace(s)
-	
+	return strings.TrimSpace(collapseBlank(strings.TrimSpace(s)))
+}
+
+// collapseBlank 连续的空白字符合并为一个空格，去掉零宽字符，不去掉首尾的空格
+func collapseBlank(s string) string {
 	// 移除多余的空白字符
 	regstr := "\\s{2,}"
 	reg, _ := regexp.Compile(regstr)
 	s = reg.ReplaceAllString(s, " ")
-	
+
 	// 处理换行符
 	s = strings.ReplaceAll(s, "\n", " ")
 	s = strings.ReplaceAll(s, "\r", " ")
-	
+
 	// 移除微信特有的空白字符
 	s = strings.ReplaceAll(s, "\u00A0", " ") // 不间断空格
 	s = strings.ReplaceAll(s, "\u200B", "")  // 零宽空格
 	s = strings.ReplaceAll(s, "\u200C", "")  // 零宽非连接符
 	s = strings.ReplaceAll(s, "\u200D", "")  // 零宽连接符
-	
+
 	// 再次清理多余空格
 	s = reg.ReplaceAllString(s, " ")
-	s = strings.TrimSpace(s)
-	
-	return s
-}
-
-func fetchImgFile(url string) []byte {
-	return fetchImgFileWithProxy(url, "")
-}
 
-func fetchImgFileWithProxy(imgURL string, proxy string) []byte {
-	req, err := http.NewRequest("GET", imgURL, nil)
-	if err != nil {
-		log.Printf("new request for image %s error: %s", imgURL, err.Error())
-		return nil
-	}
-	
-	// 设置超时
-	client := &http.Client{
-		Timeout: 30 * time.Second,
-	}
-	
-	// 如果提供了代理，设置代理
-	if proxy != "" {
-		proxyURL, err := url.Parse("http://" + proxy)
-		if err != nil {
-			log.Printf("invalid proxy format %s: %s", proxy, err.Error())
-		} else {
-			client.Transport = &http.Transport{
-				Proxy: http.ProxyURL(proxyURL),
-				// 设置连接超时
-				DialContext: (&net.Dialer{
-					Timeout:   30 * time.Second,
-					KeepAlive: 30 * time.Second,
-				}).DialContext,
-				// 设置空闲连接超时
-				IdleConnTimeout:       90 * time.Second,
-				TLSHandshakeTimeout:   30 * time.Second,
-				ResponseHeaderTimeout: 30 * time.Second,
-			}
-		}
-	}
-	
-	res, err := client.Do(req)
-	if err != nil {
-		log.Printf("get Image from url %s error: %s", imgURL, err.Error())
-		return nil
-	}
-	defer res.Body.Close()
-	if res.StatusCode != 200 {
-		log.Printf("get Image from url %s error: %d %s", imgURL, res.StatusCode, res.Status)
-		return nil
-	}
-	content, err := io.ReadAll(res.Body)
-	if err != nil {
-		log.Printf("read image Response error: %s", err.Error())
-		return nil
-	}
-	return content
+	return s
 }
 
 func img2base64(content []byte) string {
@@ -513,3 +807,54 @@ func ImageArgValue2ImagePolicy(val string) ImagePolicy {
 	}
 	return imagePolicy
 }
+
+// ImageQuality 微信图片（mmbiz.qpic.cn）的请求方式
+type ImageQuality int32
+
+const (
+	// IMAGE_QUALITY_ORIGINAL 保持原图格式（gif动图、透明png），并请求最高分辨率
+	IMAGE_QUALITY_ORIGINAL ImageQuality = iota
+	// IMAGE_QUALITY_COMPACT 统一请求jpeg格式，体积更小
+	IMAGE_QUALITY_COMPACT
+)
+
+func ImageArgValue2ImageQuality(val string) ImageQuality {
+	var imageQuality ImageQuality
+	switch val {
+	case "compact":
+		imageQuality = IMAGE_QUALITY_COMPACT
+	case "original":
+		fallthrough
+	default:
+		imageQuality = IMAGE_QUALITY_ORIGINAL
+	}
+	return imageQuality
+}
+
+// 微信图片路径末尾的尺寸，如 /640、/300，替换为 /0 即为原图
+var mmbizSizeSuffix = regexp.MustCompile(`/[0-9]+$`)
+
+// mmbizImageURL 按 quality 改写微信图片的url
+func mmbizImageURL(src string, quality ImageQuality) string {
+	u, err := url.Parse(src)
+	if err != nil {
+		return src
+	}
+	if quality == IMAGE_QUALITY_COMPACT {
+		// 统一转成jpeg
+		query := u.Query()
+		if query.Has("wx_fmt") {
+			query.Set("wx_fmt", "jpeg")
+			u.RawQuery = query.Encode()
+		}
+		return u.String()
+	}
+	u.Path = mmbizSizeSuffix.ReplaceAllString(u.Path, "/0")
+	query := u.Query()
+	// tp=webp 会让服务端把图片转码成webp，wx_lazy、wx_co 是懒加载相关的参数
+	query.Del("tp")
+	query.Del("wx_lazy")
+	query.Del("wx_co")
+	u.RawQuery = query.Encode()
+	return u.String()
+}
@@ -0,0 +1,229 @@
+package parse
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// firstElement 解析html片段，返回 body 中的第一个元素
+func firstElement(t *testing.T, html string) *goquery.Selection {
+	t.Helper()
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader("<html><body>" + html + "</body></html>"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return doc.Find("body").Children().First()
+}
+
+func TestInlineStyles(t *testing.T) {
+	tests := []struct {
+		html string
+		want []PieceType
+	}{
+		{`<span>普通</span>`, nil},
+		{`<span style="font-weight: bold">粗体</span>`, []PieceType{BOLD_TEXT}},
+		{`<span style="font-weight:700">粗体</span>`, []PieceType{BOLD_TEXT}},
+		{`<span style="font-weight: 600 !important">粗体</span>`, []PieceType{BOLD_TEXT}},
+		{`<span style="font-weight: 400">常规</span>`, nil},
+		{`<span style="font-weight: normal">常规</span>`, nil},
+		{`<span style="FONT-STYLE: Italic">斜体</span>`, []PieceType{ITALIC_TEXT}},
+		{`<span style="font-style: oblique">斜体</span>`, []PieceType{ITALIC_TEXT}},
+		{`<span style="text-decoration: underline">下划线</span>`, []PieceType{UNDERLINE_TEXT}},
+		{`<span style="text-decoration: line-through">删除线</span>`, []PieceType{STRIKETHROUGH_TEXT}},
+		{`<span style="text-decoration: underline line-through red">两者</span>`, []PieceType{UNDERLINE_TEXT, STRIKETHROUGH_TEXT}},
+		{`<span style="text-decoration-line: line-through">删除线</span>`, []PieceType{STRIKETHROUGH_TEXT}},
+		{`<span style="text-decoration: none">无</span>`, nil},
+		{`<span style="background-color: rgb(255, 255, 0)">高亮</span>`, []PieceType{HIGHLIGHT_TEXT}},
+		{`<span style="background: #ffe58f">高亮</span>`, []PieceType{HIGHLIGHT_TEXT}},
+		{`<span style="background-color: #FFFFFF">白底</span>`, nil},
+		{`<span style="background-color: rgb(255, 255, 255)">白底</span>`, nil},
+		{`<span style="background-color: transparent">透明</span>`, nil},
+		{`<span style="background-color: rgba(12, 34, 56, 0)">透明</span>`, nil},
+		{`<span style="background: url(a.png)">图片</span>`, nil},
+		{`<span style="background: linear-gradient(red, blue)">渐变</span>`, nil},
+		{`<font style="font-weight: bold; font-style: italic; background-color: yellow">全部</font>`, []PieceType{BOLD_TEXT, ITALIC_TEXT, HIGHLIGHT_TEXT}},
+		{`<u>下划线</u>`, []PieceType{UNDERLINE_TEXT}},
+		{`<ins>下划线</ins>`, []PieceType{UNDERLINE_TEXT}},
+		{`<del>删除线</del>`, []PieceType{STRIKETHROUGH_TEXT}},
+		{`<s>删除线</s>`, []PieceType{STRIKETHROUGH_TEXT}},
+		{`<strike>删除线</strike>`, []PieceType{STRIKETHROUGH_TEXT}},
+		{`<mark>高亮</mark>`, []PieceType{HIGHLIGHT_TEXT}},
+		{`<del style="font-weight: bold">两者</del>`, []PieceType{BOLD_TEXT, STRIKETHROUGH_TEXT}},
+		{`<span style="font-weight: bold"><p>段落</p></span>`, nil},
+		{`<div style="font-weight: bold">块</div>`, nil},
+	}
+	for _, tt := range tests {
+		got := inlineStyles(firstElement(t, tt.html))
+		if len(got) != len(tt.want) {
+			t.Errorf("inlineStyles(%s) = %v, want %v", tt.html, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("inlineStyles(%s) = %v, want %v", tt.html, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+// parseContent 解析 js_content 中的 html，返回正文
+func parseContent(t *testing.T, html string) []Piece {
+	t.Helper()
+	page := `<html><body><div id="img-content"><h1 id="activity-name">标题</h1><div id="js_content">` + html + `</div></div></body></html>`
+	article, err := ParseReader(context.Background(), strings.NewReader(page), Options{ImagePolicy: IMAGE_POLICY_URL, Fetcher: offlineFetcher(t)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return article.Content
+}
+
+// inlineMarkup 以紧凑的形式表示 pieces 的结构，如 b(粗体)、a[href](链接)，换行为 “|”
+func inlineMarkup(pieces []Piece) string {
+	names := map[PieceType]string{BOLD_TEXT: "b", ITALIC_TEXT: "i", BOLD_ITALIC_TEXT: "bi", CODE_INLINE: "code"}
+	var sb strings.Builder
+	for _, piece := range pieces {
+		var val string
+		switch v := piece.Val.(type) {
+		case string:
+			val = v
+		case []Piece:
+			val = inlineMarkup(v)
+		}
+		switch piece.Type {
+		case NORMAL_TEXT:
+			sb.WriteString(val)
+		case BR:
+			sb.WriteString("|")
+		case LINK:
+			sb.WriteString("a[" + piece.Attrs["href"] + "](" + val + ")")
+		default:
+			sb.WriteString(names[piece.Type] + "(" + val + ")")
+		}
+	}
+	return sb.String()
+}
+
+func TestParseInline(t *testing.T) {
+	tests := []struct {
+		name string
+		html string
+		want string
+	}{
+		{"nested bold italic", `<p>前 <strong>粗体 <em>斜体</em></strong> 后</p>`, "前 b(粗体 i(斜体)) 后|"},
+		{"spaces moved outside", `<p>前<strong> 粗体 </strong>后</p>`, "前 b(粗体) 后|"},
+		{"bold only italic", `<p><strong><em>粗斜体</em></strong></p>`, "bi(粗斜体)|"},
+		{"link between text", `<p>见 <a href="https://a.com">链接</a> 之后</p><p>下一段</p>`, "见 a[https://a.com](链接) 之后||下一段|"},
+		{"no line break after link", `<p><a href="https://a.com">链接</a>紧跟文字</p>`, "a[https://a.com](链接)紧跟文字|"},
+		{"link between spans", `<p><span>a</span><a href="https://a.com">b</a><span>c</span></p>`, "aa[https://a.com](b)c|"},
+		{"bold in link", `<p><a href="https://a.com"><strong>粗体</strong> 链接</a>，文字</p>`, "a[https://a.com](b(粗体) 链接)，文字|"},
+		{"link in bold", `<p><strong>粗体<a href="https://a.com">链接</a></strong>文字</p>`, "b(粗体a[https://a.com](链接))文字|"},
+		{"code trimmed", `<p>代码 <code> x := 1 </code> 结束</p>`, "代码 code(x := 1) 结束|"},
+		{"code in bold trimmed", `<p><strong>代码<code> y </code></strong></p>`, "b(代码code(y))|"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := inlineMarkup(parseContent(t, tt.html)); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsDivider(t *testing.T) {
+	tests := []struct {
+		html string
+		want bool
+	}{
+		{`<img data-ratio="0.01" data-src="line.png">`, true},
+		{`<img data-ratio="0.05" data-src="a.png">`, false},
+		{`<img data-ratio="0.75" data-src="a.png">`, false},
+		{`<img data-src="a.png">`, false},
+		{`<img data-ratio="0" data-src="a.png">`, false},
+		{`<section style="border-top: 1px solid #ccc"></section>`, true},
+		{`<section style="border-bottom: 2px dashed rgb(0, 0, 0)"><br></section>`, true},
+		{`<p style="border-top: 1px dotted red"> </p>`, true},
+		{`<div style="border-bottom: 3px double #000"></div>`, true},
+		{`<section style="border-top: none"></section>`, false},
+		{`<section style="border-top: 0px solid #ccc"></section>`, false},
+		{`<section style="border-top: 0 solid #ccc"></section>`, false},
+		{`<section style="border-top: 1px hidden #ccc"></section>`, false},
+		{`<section style="border-left: 3px solid #ccc"></section>`, false},
+		{`<section style="border-top: 1px solid #ccc">文字</section>`, false},
+		{`<section style="border-top: 1px solid #ccc"><img data-src="a.png"></section>`, false},
+		{`<section style="height: 2px; background-color: #333"></section>`, true},
+		{`<section style="height: 1pt; background: rgb(200, 0, 0)"></section>`, true},
+		{`<section style="height: 10px; background-color: #333"></section>`, false},
+		{`<section style="height: 2px; background-color: #fff"></section>`, false},
+		{`<section style="height: 2px; background-color: transparent"></section>`, false},
+		{`<section style="height: 2px"></section>`, false},
+		{`<span style="border-top: 1px solid #ccc"></span>`, false},
+		{`<section></section>`, false},
+	}
+	for _, tt := range tests {
+		if got := isDivider(firstElement(t, tt.html)); got != tt.want {
+			t.Errorf("isDivider(%s) = %v, want %v", tt.html, got, tt.want)
+		}
+	}
+}
+
+func TestMmbizImageURL(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		quality ImageQuality
+		want    string
+	}{
+		{"original keeps gif", "https://mmbiz.qpic.cn/mmbiz_gif/a/640?wx_fmt=gif", IMAGE_QUALITY_ORIGINAL, "https://mmbiz.qpic.cn/mmbiz_gif/a/0?wx_fmt=gif"},
+		{"original keeps png", "https://mmbiz.qpic.cn/mmbiz_png/a/300?wx_fmt=png&tp=webp&wxfrom=5&wx_lazy=1&wx_co=1", IMAGE_QUALITY_ORIGINAL, "https://mmbiz.qpic.cn/mmbiz_png/a/0?wx_fmt=png&wxfrom=5"},
+		{"original without size", "https://mmbiz.qpic.cn/mmbiz_jpg/a?wx_fmt=jpeg", IMAGE_QUALITY_ORIGINAL, "https://mmbiz.qpic.cn/mmbiz_jpg/a?wx_fmt=jpeg"},
+		{"compact converts gif", "https://mmbiz.qpic.cn/mmbiz_gif/a/640?wx_fmt=gif", IMAGE_QUALITY_COMPACT, "https://mmbiz.qpic.cn/mmbiz_gif/a/640?wx_fmt=jpeg"},
+		{"compact converts png", "https://mmbiz.qpic.cn/mmbiz_png/a/640?wx_fmt=png&tp=webp", IMAGE_QUALITY_COMPACT, "https://mmbiz.qpic.cn/mmbiz_png/a/640?tp=webp&wx_fmt=jpeg"},
+		{"compact without wx_fmt", "https://mmbiz.qpic.cn/mmbiz_png/a/640", IMAGE_QUALITY_COMPACT, "https://mmbiz.qpic.cn/mmbiz_png/a/640"},
+		{"invalid url", "https://mmbiz.qpic.cn/%zz", IMAGE_QUALITY_ORIGINAL, "https://mmbiz.qpic.cn/%zz"},
+	}
+	for _, tt := range tests {
+		if got := mmbizImageURL(tt.src, tt.quality); got != tt.want {
+			t.Errorf("%s: mmbizImageURL(%s) = %s, want %s", tt.name, tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestImageQualityRequests(t *testing.T) {
+	const page = `<html><body><div id="img-content"><h1 id="activity-name">图片</h1><div id="js_content">
+<p><img data-src="https://mmbiz.qpic.cn/mmbiz_gif/a/640?wx_fmt=gif"></p>
+<p><img data-src="https://example.com/b.png?wx_fmt=png"></p></div></div></body></html>`
+	tests := []struct {
+		quality string
+		want    []string
+	}{
+		{"original", []string{"https://mmbiz.qpic.cn/mmbiz_gif/a/0?wx_fmt=gif", "https://example.com/b.png?wx_fmt=png"}},
+		{"compact", []string{"https://mmbiz.qpic.cn/mmbiz_gif/a/640?wx_fmt=jpeg", "https://example.com/b.png?wx_fmt=png"}},
+		{"", []string{"https://mmbiz.qpic.cn/mmbiz_gif/a/0?wx_fmt=gif", "https://example.com/b.png?wx_fmt=png"}},
+	}
+	for _, tt := range tests {
+		var requests []string
+		fetcher := FetcherFunc(func(ctx context.Context, req *FetchRequest) (*FetchResponse, error) {
+			if req.Kind == RESOURCE_PAGE {
+				return &FetchResponse{URL: req.URL, Body: []byte(page)}, nil
+			}
+			requests = append(requests, req.URL)
+			return &FetchResponse{URL: req.URL, Body: []byte("image")}, nil
+		})
+		opts := Options{
+			ImagePolicy:  IMAGE_POLICY_BASE64,
+			ImageQuality: ImageArgValue2ImageQuality(tt.quality),
+			Fetcher:      fetcher,
+			Limits:       Limits{MaxConcurrentImages: 1},
+		}
+		if _, err := Parse(context.Background(), parserTestURL, opts); err != nil {
+			t.Fatal(err)
+		}
+		if strings.Join(requests, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("quality %q: requests = %v, want %v", tt.quality, requests, tt.want)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package parse
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultTimeout = 30 * time.Second
+
+// Parser 按照 Options 解析公众号文章，可在多次解析间复用（并发安全）
+type Parser struct {
+	opts    Options
+	fetcher Fetcher
+	// placeholderDigests Options.HotlinkPlaceholderDigests 的副本，创建后只读
+	placeholderDigests map[string]bool
+}
+
+// NewParser 根据 opts 创建 Parser
+func NewParser(opts Options) (*Parser, error) {
+	if opts.Fetcher == nil {
+		httpFetcher, err := NewHTTPFetcher(opts.Proxy)
+		if err != nil {
+			return nil, err
+		}
+		opts.Fetcher = httpFetcher
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultTimeout
+	}
+	opts.HeaderProfile = opts.HeaderProfile.withDefaults()
+	opts.Headings = opts.Headings.withDefaults()
+	if opts.HotlinkDetector == nil {
+		opts.HotlinkDetector = DefaultHotlinkDetector
+	}
+	placeholderDigests := make(map[string]bool)
+	for _, digest := range opts.HotlinkPlaceholderDigests {
+		placeholderDigests[strings.ToLower(digest)] = true
+	}
+	return &Parser{opts: opts, fetcher: opts.Fetcher, placeholderDigests: placeholderDigests}, nil
+}
+
+// Parse 请求公众号文章url并解析，失败时返回错误而不是空的 Article
+func Parse(ctx context.Context, src string, opts Options) (Article, error) {
+	p, err := NewParser(opts)
+	if err != nil {
+		return Article{}, err
+	}
+	return p.Parse(ctx, src)
+}
+
+// ParseReader 从 r 中读取文章html并解析
+func ParseReader(ctx context.Context, r io.Reader, opts Options) (Article, error) {
+	p, err := NewParser(opts)
+	if err != nil {
+		return Article{}, err
+	}
+	return p.ParseReader(ctx, r)
+}
+
+// Parse 请求公众号文章url并解析
+func (ps *Parser) Parse(ctx context.Context, src string) (Article, error) {
+	p := ps.newParser(ctx)
+	p.pageURL = src
+	body, err := p.fetchPage(src)
+	if err != nil {
+		return Article{}, err
+	}
+	return p.parseDocument(bytes.NewReader(body))
+}
+
+// ParseReader 从 r 中读取文章html并解析
+func (ps *Parser) ParseReader(ctx context.Context, r io.Reader) (Article, error) {
+	return ps.newParser(ctx).parseDocument(r)
+}
+
+// parser 保存一次解析过程中的状态
+type parser struct {
+	*Parser
+	ctx context.Context
+	// pageURL 文章的url，作为图片请求的 Referer
+	pageURL string
+	// baseDir 解析本地html时文件所在的目录，用于读取本地图片
+	baseDir string
+	// 正文中待下载的图片，key为图片url
+	images    map[string]*FetchResponse
+	imageURLs []string
+	// localImages 可以从本地读取的图片，key为图片url
+	localImages map[string]string
+	// resources MHTML、WARC 中内嵌的资源，key为 resourceKey
+	resources map[string]*FetchResponse
+	// headings 推断出的标题，lineCount 为参与推断的正文行数
+	headings  []headingCandidate
+	lineCount int
+	// hotlinkDigest 探测到的防盗链占位图的md5，见 hotlinkPlaceholder
+	hotlinkOnce   sync.Once
+	hotlinkDigest string
+}
+
+func (ps *Parser) newParser(ctx context.Context) *parser {
+	return &parser{Parser: ps, ctx: ctx}
+}
+
+// fetch 通过 p.fetcher 获取资源，失败时按 Options.Retry 重试，单次请求的超时为 Options.Timeout
+func (p *parser) fetch(req *FetchRequest) (*FetchResponse, error) {
+	header := http.Header{}
+	for k, v := range req.Header {
+		header[k] = v
+	}
+	for k, v := range p.opts.Header {
+		header[k] = v
+	}
+	req.Header = header
+	retry := p.opts.Retry.withDefaults()
+	for attempt := 0; ; attempt++ {
+		res, err := p.fetchOnce(req)
+		if err == nil || p.ctx.Err() != nil || attempt >= retry.MaxRetries || !isRetryable(err) {
+			return res, err
+		}
+		delay := retry.backoff(attempt, err)
+		log.Printf("%s, retry after %s", err.Error(), delay)
+		if err := sleepContext(p.ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *parser) fetchOnce(req *FetchRequest) (*FetchResponse, error) {
+	ctx, cancel := context.WithTimeout(p.ctx, p.opts.Timeout)
+	defer cancel()
+	res, err := p.fetcher.Fetch(ctx, req)
+	if err != nil && p.ctx.Err() != nil {
+		// 外部取消，直接返回 ctx 的错误
+		return nil, p.ctx.Err()
+	}
+	return res, err
+}
+
+func (p *parser) fetchPage(targetURL string) ([]byte, error) {
+	header := p.opts.HeaderProfile.pageHeader()
+	res, err := p.fetch(&FetchRequest{URL: targetURL, Kind: RESOURCE_PAGE, Header: header})
+	if err != nil {
+		return nil, err
+	}
+	if limit := p.opts.Limits.MaxPageBytes; limit > 0 && int64(len(res.Body)) > limit {
+		return nil, fmt.Errorf("page %s exceeds %d bytes", targetURL, limit)
+	}
+	return res.Body, nil
+}
+
+func (p *parser) fetchImgFile(imgURL string) (*FetchResponse, error) {
+	var res *FetchResponse
+	var err error
+	if path, ok := p.localImages[imgURL]; ok {
+		res, err = readLocalImage(imgURL, path)
+		if err != nil {
+			return nil, err
+		}
+	} else if embedded, ok := p.resource(imgURL); ok {
+		res = embedded
+	} else {
+		req := &FetchRequest{URL: imgURL, Kind: RESOURCE_IMAGE, Header: p.opts.HeaderProfile.imageHeader(p.pageURL)}
+		res, err = p.fetch(req)
+		if err != nil {
+			return nil, err
+		}
+		if p.opts.HotlinkDetector(req, res) || p.isHotlinkPlaceholder(imgURL, res) {
+			return nil, ErrHotlinkPlaceholder
+		}
+	}
+	if limit := p.opts.Limits.MaxImageBytes; limit > 0 && int64(len(res.Body)) > limit {
+		return nil, fmt.Errorf("%w: exceeds %d bytes", ErrImageLimit, limit)
+	}
+	if p.opts.Hooks.AfterImage != nil {
+		p.opts.Hooks.AfterImage(imgURL, res)
+	}
+	return res, nil
+}
@@ -0,0 +1,128 @@
+package parse
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+const parserTestURL = "https://mp.weixin.qq.com/s/test"
+
+const parserTestPage = `<html><body><div id="img-content">
+<h1 id="activity-name"> 测试文章 </h1>
+<div id="meta_content"><a id="js_name"> 测试公众号 </a></div>
+<div id="js_content">
+<p>第一段</p>
+<p><img data-src="https://mmbiz.qpic.cn/mmbiz_png/ok/640?wx_fmt=png&amp;tp=webp"></p>
+<p><img data-src="https://example.com/flaky.png"></p>
+<p><img data-src="https://example.com/missing.png"></p>
+</div></div></body></html>`
+
+// fakeSite 离线的文章页面和图片，flaky 第一次请求时返回 503
+type fakeSite struct {
+	mu       sync.Mutex
+	requests map[string]int
+	referers map[string]string
+}
+
+func (fs *fakeSite) fetch(ctx context.Context, req *FetchRequest) (*FetchResponse, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if req.Header.Get("Referer") == hotlinkProbeReferer {
+		return &FetchResponse{URL: req.URL, Body: []byte("probe " + req.URL)}, nil
+	}
+	fs.requests[req.URL]++
+	fs.referers[req.URL] = req.Header.Get("Referer")
+	switch {
+	case req.URL == parserTestURL && req.Kind == RESOURCE_PAGE:
+		return &FetchResponse{URL: req.URL, Header: http.Header{"Content-Type": {"text/html"}}, Body: []byte(parserTestPage)}, nil
+	case req.URL == "https://mmbiz.qpic.cn/mmbiz_png/ok/0?wx_fmt=png" && req.Kind == RESOURCE_IMAGE:
+		return &FetchResponse{URL: req.URL, Header: http.Header{"Content-Type": {"image/png"}}, Body: []byte("ok-image")}, nil
+	case req.URL == "https://example.com/flaky.png" && fs.requests[req.URL] == 1:
+		return nil, &HTTPStatusError{URL: req.URL, StatusCode: http.StatusServiceUnavailable, Status: "503 Service Unavailable"}
+	case req.URL == "https://example.com/flaky.png":
+		return &FetchResponse{URL: req.URL, Header: http.Header{"Content-Type": {"image/png"}}, Body: []byte("flaky-image")}, nil
+	}
+	return nil, &HTTPStatusError{URL: req.URL, StatusCode: http.StatusNotFound, Status: "404 Not Found"}
+}
+
+func TestParserWithFakeFetcher(t *testing.T) {
+	site := &fakeSite{requests: make(map[string]int), referers: make(map[string]string)}
+	parser, err := NewParser(Options{
+		ImagePolicy: IMAGE_POLICY_BASE64,
+		Fetcher:     FetcherFunc(site.fetch),
+		Retry:       RetryPolicy{MaxRetries: 2, BaseDelay: time.Millisecond},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	article, err := parser.Parse(context.Background(), parserTestURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := article.Title.Val; got != "测试文章" {
+		t.Errorf("title = %q, want %q", got, "测试文章")
+	}
+	if article.Account != "测试公众号" {
+		t.Errorf("account = %q, want %q", article.Account, "测试公众号")
+	}
+
+	images := make(map[string]string)
+	for _, piece := range article.Content {
+		if piece.Type == IMAGE_BASE64 {
+			images[piece.Attrs["src"]] = piece.Val.(string)
+		}
+	}
+	wantImages := map[string]string{
+		"https://mmbiz.qpic.cn/mmbiz_png/ok/0?wx_fmt=png": "ok-image",
+		"https://example.com/flaky.png":                   "flaky-image",
+		"https://example.com/missing.png":                 "",
+	}
+	for src, want := range wantImages {
+		got, ok := images[src]
+		if !ok {
+			t.Errorf("image %s not found in content", src)
+			continue
+		}
+		if want != "" {
+			want = base64.StdEncoding.EncodeToString([]byte(want))
+		}
+		if got != want {
+			t.Errorf("image %s = %q, want %q", src, got, want)
+		}
+	}
+
+	if len(article.FailedImages) != 1 || article.FailedImages[0].URL != "https://example.com/missing.png" {
+		t.Fatalf("failed images = %v, want only missing.png", article.FailedImages)
+	}
+	var statusErr *HTTPStatusError
+	if !errors.As(article.FailedImages[0].Err, &statusErr) || statusErr.StatusCode != http.StatusNotFound {
+		t.Errorf("failed image error = %v, want 404", article.FailedImages[0].Err)
+	}
+	// 404 不重试，503 重试一次
+	if n := site.requests["https://example.com/missing.png"]; n != 1 {
+		t.Errorf("missing.png requested %d times, want 1", n)
+	}
+	if n := site.requests["https://example.com/flaky.png"]; n != 2 {
+		t.Errorf("flaky.png requested %d times, want 2", n)
+	}
+	if referer := site.referers["https://example.com/flaky.png"]; referer != parserTestURL {
+		t.Errorf("image referer = %q, want %q", referer, parserTestURL)
+	}
+}
+
+func TestParserPageError(t *testing.T) {
+	site := &fakeSite{requests: make(map[string]int), referers: make(map[string]string)}
+	_, err := Parse(context.Background(), "https://mp.weixin.qq.com/s/gone", Options{
+		Fetcher: FetcherFunc(site.fetch),
+		Retry:   RetryPolicy{MaxRetries: -1},
+	})
+	var statusErr *HTTPStatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusNotFound {
+		t.Errorf("err = %v, want 404", err)
+	}
+}
@@ -0,0 +1,86 @@
+package parse
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultMaxRetries = 2
+	defaultBaseDelay  = 500 * time.Millisecond
+	defaultMaxDelay   = 10 * time.Second
+)
+
+// RetryPolicy 请求失败时的重试策略，网络错误、429 和 5xx 会被重试
+type RetryPolicy struct {
+	// MaxRetries 最多重试次数，为 0 时默认为 2，小于 0 时不重试
+	MaxRetries int
+	// BaseDelay 第一次重试前的等待时间，之后每次翻倍，为 0 时默认为 500ms
+	BaseDelay time.Duration
+	// MaxDelay 单次等待时间的上限，为 0 时默认为 10s；服务端返回的 Retry-After 不受此限制
+	MaxDelay time.Duration
+}
+
+func (rp RetryPolicy) withDefaults() RetryPolicy {
+	if rp.MaxRetries == 0 {
+		rp.MaxRetries = defaultMaxRetries
+	}
+	if rp.BaseDelay <= 0 {
+		rp.BaseDelay = defaultBaseDelay
+	}
+	if rp.MaxDelay <= 0 {
+		rp.MaxDelay = defaultMaxDelay
+	}
+	return rp
+}
+
+// backoff 第 attempt 次（从0开始）重试前的等待时间：指数退避，并在 [d/2, d) 之间随机抖动
+func (rp RetryPolicy) backoff(attempt int, err error) time.Duration {
+	var statusErr *HTTPStatusError
+	if errors.As(err, &statusErr) && statusErr.RetryAfter > 0 {
+		return statusErr.RetryAfter
+	}
+	d := rp.BaseDelay << uint(attempt)
+	if d <= 0 || d > rp.MaxDelay {
+		d = rp.MaxDelay
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+func isRetryable(err error) bool {
+	var statusErr *HTTPStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode == http.StatusTooManyRequests || statusErr.StatusCode >= 500
+	}
+	var netErr *NetworkError
+	return errors.As(err, &netErr)
+}
+
+// 解析 Retry-After 响应头，支持秒数和 HTTP 日期两种格式
+func parseRetryAfter(val string) time.Duration {
+	if val == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(val); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(val); err == nil && time.Until(t) > 0 {
+		return time.Until(t)
+	}
+	return 0
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
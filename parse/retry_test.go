@@ -0,0 +1,75 @@
+package parse
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		name string
+		val  string
+		min  time.Duration
+		max  time.Duration
+	}{
+		{"empty", "", 0, 0},
+		{"seconds", "120", 120 * time.Second, 120 * time.Second},
+		{"zero seconds", "0", 0, 0},
+		{"negative seconds", "-5", 0, 0},
+		{"http date", time.Now().Add(time.Minute).UTC().Format(http.TimeFormat), 50 * time.Second, time.Minute},
+		{"http date in the past", time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat), 0, 0},
+		{"invalid", "soon", 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseRetryAfter(tt.val); got < tt.min || got > tt.max {
+				t.Errorf("parseRetryAfter(%q) = %s, want [%s, %s]", tt.val, got, tt.min, tt.max)
+			}
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	rp := RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}.withDefaults()
+	tests := []struct {
+		name    string
+		attempt int
+		err     error
+		min     time.Duration
+		max     time.Duration
+	}{
+		{"first retry", 0, errors.New("x"), 50 * time.Millisecond, 100 * time.Millisecond},
+		{"doubled", 2, errors.New("x"), 200 * time.Millisecond, 400 * time.Millisecond},
+		{"capped by max delay", 10, errors.New("x"), 500 * time.Millisecond, time.Second},
+		{"shift overflow capped", 80, errors.New("x"), 500 * time.Millisecond, time.Second},
+		{"retry after wins", 0, &HTTPStatusError{StatusCode: http.StatusTooManyRequests, RetryAfter: 30 * time.Second}, 30 * time.Second, 30 * time.Second},
+		{"zero retry after ignored", 0, &HTTPStatusError{StatusCode: http.StatusServiceUnavailable}, 50 * time.Millisecond, 100 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := 0; i < 20; i++ {
+				if got := rp.backoff(tt.attempt, tt.err); got < tt.min || got > tt.max {
+					t.Fatalf("backoff(%d) = %s, want [%s, %s]", tt.attempt, got, tt.min, tt.max)
+				}
+			}
+		})
+	}
+}
+
+func TestRetryPolicyDefaults(t *testing.T) {
+	tests := []struct {
+		in   RetryPolicy
+		want RetryPolicy
+	}{
+		{RetryPolicy{}, RetryPolicy{MaxRetries: defaultMaxRetries, BaseDelay: defaultBaseDelay, MaxDelay: defaultMaxDelay}},
+		{RetryPolicy{MaxRetries: -1}, RetryPolicy{MaxRetries: -1, BaseDelay: defaultBaseDelay, MaxDelay: defaultMaxDelay}},
+		{RetryPolicy{MaxRetries: 5, BaseDelay: time.Second, MaxDelay: time.Minute}, RetryPolicy{MaxRetries: 5, BaseDelay: time.Second, MaxDelay: time.Minute}},
+	}
+	for _, tt := range tests {
+		if got := tt.in.withDefaults(); got != tt.want {
+			t.Errorf("%+v.withDefaults() = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+}
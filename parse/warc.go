@@ -0,0 +1,215 @@
+package parse
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// ParseWARC 解析网页归档工具保存的 WARC 文件（支持 .warc.gz），
+// 以其中的文章html作为正文，图片从归档的响应中读取，不再请求网络。
+// r 可以 Seek 时（如 *os.File）先找到正文，再只读取正文中引用的图片；否则保留所有图片记录
+func (ps *Parser) ParseWARC(ctx context.Context, r io.Reader) (Article, error) {
+	p := ps.newParser(ctx)
+	var keepImage func(rawURL string) bool
+	if rs, ok := r.(io.ReadSeeker); ok {
+		page, err := p.readWARC(r, func(string) bool { return false })
+		if err != nil {
+			return Article{}, err
+		}
+		images := referencedImages(page.Body)
+		keepImage = func(rawURL string) bool { return images[resourceKey(rawURL)] }
+		if _, err := rs.Seek(0, io.SeekStart); err != nil {
+			return Article{}, fmt.Errorf("read warc error: %w", err)
+		}
+	}
+	page, err := p.readWARC(r, keepImage)
+	if err != nil {
+		return Article{}, err
+	}
+	p.pageURL = page.URL
+	return p.parseDocument(bytes.NewReader(page.Body))
+}
+
+// readWARC 读取归档中的记录，返回包含正文的网页，图片记录加入 p.resources。
+// keepImage 为空时保留所有图片，否则只保留 keepImage 返回 true 的
+func (p *parser) readWARC(r io.Reader, keepImage func(rawURL string) bool) (*FetchResponse, error) {
+	br := bufio.NewReader(r)
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		// 每条记录单独压缩的 .warc.gz，gzip.Reader 默认会连续读取多个gzip成员
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("read warc error: %w", err)
+		}
+		defer zr.Close()
+		br = bufio.NewReader(zr)
+	}
+
+	limits := p.opts.Limits
+	var page *FetchResponse
+	for {
+		res, err := readWARCRecord(br, limits)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("read warc error: %w", err)
+		}
+		if res == nil {
+			continue
+		}
+		if strings.HasPrefix(res.Header.Get("Content-Type"), "text/html") {
+			if limits.MaxPageBytes > 0 && int64(len(res.Body)) > limits.MaxPageBytes {
+				return nil, fmt.Errorf("page %s exceeds %d bytes", res.URL, limits.MaxPageBytes)
+			}
+			// 同一个归档中可能有多个网页，优先取包含正文的那个
+			if page == nil || (!bytes.Contains(page.Body, []byte("js_content")) && bytes.Contains(res.Body, []byte("js_content"))) {
+				page = res
+			}
+			continue
+		}
+		if keepImage == nil && !isImageResource(res) || keepImage != nil && !keepImage(res.URL) {
+			continue
+		}
+		if limits.MaxImageBytes > 0 && int64(len(res.Body)) > limits.MaxImageBytes {
+			continue
+		}
+		p.addResource(res.URL, res)
+	}
+	if page == nil {
+		return nil, errors.New("no html document in warc")
+	}
+	return page, nil
+}
+
+// referencedImages 网页中引用的图片，key 为 resourceKey
+func referencedImages(body []byte) map[string]bool {
+	images := make(map[string]bool)
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+	if err != nil {
+		return images
+	}
+	doc.Find("img").Each(func(i int, sc *goquery.Selection) {
+		for _, attr := range []string{"data-src", "src"} {
+			if src := sc.AttrOr(attr, ""); src != "" {
+				images[resourceKey(src)] = true
+			}
+		}
+	})
+	return images
+}
+
+// isImageResource 是否为图片，公众号图片有时以 application/octet-stream 保存
+func isImageResource(res *FetchResponse) bool {
+	return strings.HasPrefix(res.Header.Get("Content-Type"), "image/") || isMmbizURL(res.URL)
+}
+
+// readWARCRecord 读取一条记录，只返回 response 和 resource 类型中成功的响应，其它记录返回 nil。
+// 设置了 limits 时，超过 MaxPageBytes 和 MaxImageBytes 中较大者的记录直接跳过，不读入内存
+func readWARCRecord(br *bufio.Reader, limits Limits) (*FetchResponse, error) {
+	var version string
+	for version == "" {
+		line, err := br.ReadString('\n')
+		if err != nil && (err != io.EOF || strings.TrimSpace(line) == "") {
+			return nil, err
+		}
+		// 跳过记录之间的空行
+		version = strings.TrimSpace(line)
+	}
+	if !strings.HasPrefix(version, "WARC/") {
+		return nil, fmt.Errorf("invalid warc record: %q", version)
+	}
+	// 记录头不完整时同样是文件被截断，不能当作正常结束
+	header, err := textproto.NewReader(br).ReadMIMEHeader()
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	length, err := strconv.ParseInt(header.Get("Content-Length"), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid warc content length: %w", err)
+	}
+	if length < 0 {
+		return nil, fmt.Errorf("invalid warc content length: %d", length)
+	}
+	var maxBytes int64
+	if limits.MaxPageBytes > 0 && limits.MaxImageBytes > 0 {
+		maxBytes = limits.MaxPageBytes
+		if limits.MaxImageBytes > maxBytes {
+			maxBytes = limits.MaxImageBytes
+		}
+	}
+	if maxBytes > 0 && length > maxBytes {
+		if _, err := io.CopyN(io.Discard, br, length); err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		return nil, nil
+	}
+	// 不按 Content-Length 预先分配，文件被截断时不会占用过多内存
+	block, err := io.ReadAll(io.LimitReader(br, length))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(block)) < length {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	targetURI := strings.Trim(header.Get("WARC-Target-URI"), "<>")
+	switch header.Get("WARC-Type") {
+	case "resource":
+		return &FetchResponse{
+			URL:    targetURI,
+			Header: http.Header{"Content-Type": {header.Get("Content-Type")}},
+			Body:   block,
+		}, nil
+	case "response":
+		if !strings.HasPrefix(header.Get("Content-Type"), "application/http") {
+			return nil, nil
+		}
+		httpRes, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(block)), nil)
+		if err != nil {
+			return nil, fmt.Errorf("read warc response %s error: %w", targetURI, err)
+		}
+		defer httpRes.Body.Close()
+		if httpRes.StatusCode != http.StatusOK {
+			return nil, nil
+		}
+		var body io.Reader = httpRes.Body
+		if strings.EqualFold(httpRes.Header.Get("Content-Encoding"), "gzip") {
+			zr, err := gzip.NewReader(body)
+			if err != nil {
+				return nil, fmt.Errorf("read warc response %s error: %w", targetURI, err)
+			}
+			defer zr.Close()
+			body = zr
+			if maxBytes > 0 {
+				// 解压后的大小同样受限制
+				body = io.LimitReader(body, maxBytes+1)
+			}
+		}
+		content, err := io.ReadAll(body)
+		if err != nil {
+			return nil, fmt.Errorf("read warc response %s error: %w", targetURI, err)
+		}
+		if maxBytes > 0 && int64(len(content)) > maxBytes {
+			return nil, nil
+		}
+		return &FetchResponse{URL: targetURI, Header: httpRes.Header, Body: content}, nil
+	}
+	return nil, nil
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,217 @@
+package parse
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"testing"
+)
+
+const archiveTestPage = `<html><body><div id="img-content">
+<h1 id="activity-name">归档文章</h1>
+<div id="js_content">
+<p>正文</p>
+<p><img data-src="https://mmbiz.qpic.cn/mmbiz_png/a/640?wx_fmt=png"></p>
+</div></div></body></html>`
+
+// warcRecord 一条 WARC 记录，length 为空时使用 block 的实际长度
+func warcRecord(recordType string, uri string, contentType string, block string, length string) string {
+	if length == "" {
+		length = fmt.Sprint(len(block))
+	}
+	return "WARC/1.0\r\n" +
+		"WARC-Type: " + recordType + "\r\n" +
+		"WARC-Target-URI: <" + uri + ">\r\n" +
+		"Content-Type: " + contentType + "\r\n" +
+		"Content-Length: " + length + "\r\n" +
+		"\r\n" + block + "\r\n\r\n"
+}
+
+// warcResponse response 类型的记录，block 为完整的 HTTP 响应
+func warcResponse(uri string, status string, contentType string, body string) string {
+	block := "HTTP/1.1 " + status + "\r\n" +
+		"Content-Type: " + contentType + "\r\n" +
+		fmt.Sprintf("Content-Length: %d\r\n", len(body)) +
+		"\r\n" + body
+	return warcRecord("response", uri, "application/http; msgtype=response", block, "")
+}
+
+// gzipRecords 每条记录单独压缩为一个gzip成员
+func gzipRecords(t *testing.T, records ...string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	for _, record := range records {
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write([]byte(record)); err != nil {
+			t.Fatal(err)
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return buf.Bytes()
+}
+
+// offlineFetcher 归档文件的解析不应请求网络
+func offlineFetcher(t *testing.T) Fetcher {
+	return FetcherFunc(func(ctx context.Context, req *FetchRequest) (*FetchResponse, error) {
+		t.Errorf("unexpected request %s", req.URL)
+		return nil, errors.New("offline")
+	})
+}
+
+// archiveImages 正文中图片的url及内容
+func archiveImages(article Article) map[string]string {
+	images := make(map[string]string)
+	for _, piece := range article.Content {
+		if piece.Type == IMAGE_BASE64 {
+			content, _ := base64.StdEncoding.DecodeString(piece.Val.(string))
+			images[piece.Attrs["src"]] = string(content)
+		}
+	}
+	return images
+}
+
+func TestParseWARC(t *testing.T) {
+	records := []string{
+		warcRecord("warcinfo", "", "application/warc-fields", "software: test\r\n", ""),
+		warcRecord("request", "https://mp.weixin.qq.com/s/abc", "application/http; msgtype=request", "GET /s/abc HTTP/1.1\r\n\r\n", ""),
+		warcResponse("https://mp.weixin.qq.com/s/abc", "200 OK", "text/html; charset=utf-8", archiveTestPage),
+		warcResponse("https://mmbiz.qpic.cn/mmbiz_png/a/0?wx_fmt=png", "200 OK", "image/png", "image-a"),
+		warcResponse("https://mmbiz.qpic.cn/mmbiz_png/missing/0", "404 Not Found", "image/png", "not found"),
+	}
+	plain := []byte(strings.Join(records, ""))
+	tests := []struct {
+		name string
+		r    func() io.Reader
+	}{
+		{"warc", func() io.Reader { return bytes.NewReader(plain) }},
+		{"warc without seek", func() io.Reader { return struct{ io.Reader }{bytes.NewReader(plain)} }},
+		{"warc.gz", func() io.Reader { return bytes.NewReader(gzipRecords(t, records...)) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := NewParser(Options{ImagePolicy: IMAGE_POLICY_BASE64, Fetcher: offlineFetcher(t)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			article, err := p.ParseWARC(context.Background(), tt.r())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if title := article.Title.Val; title != "归档文章" {
+				t.Errorf("title = %q, want %q", title, "归档文章")
+			}
+			if article.URL != "https://mp.weixin.qq.com/s/abc" {
+				t.Errorf("url = %q", article.URL)
+			}
+			images := archiveImages(article)
+			if got := images["https://mmbiz.qpic.cn/mmbiz_png/a/0?wx_fmt=png"]; got != "image-a" {
+				t.Errorf("images = %q, want image-a from the archive", images)
+			}
+			if len(article.FailedImages) != 0 {
+				t.Errorf("failed images = %v", article.FailedImages)
+			}
+		})
+	}
+}
+
+func TestReadWARCErrors(t *testing.T) {
+	page := warcResponse("https://mp.weixin.qq.com/s/abc", "200 OK", "text/html", archiveTestPage)
+	image := warcRecord("resource", "https://mmbiz.qpic.cn/mmbiz_png/a/0", "image/png", "image-a", "")
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr string
+		is      error
+	}{
+		{"truncated record", []byte(page + image[:len(image)-10]), "", io.ErrUnexpectedEOF},
+		{"truncated warc.gz", gzipRecords(t, page, image[:len(image)-10]), "", io.ErrUnexpectedEOF},
+		{"truncated header", []byte(page + "WARC/1.0\r\nWARC-Type: resource\r\n"), "", io.ErrUnexpectedEOF},
+		{"negative length", []byte(warcRecord("resource", "https://example.com/a.png", "image/png", "x", "-5")), "invalid warc content length", nil},
+		{"invalid length", []byte(warcRecord("resource", "https://example.com/a.png", "image/png", "x", "abc")), "invalid warc content length", nil},
+		{"not a warc file", []byte("<html></html>"), "invalid warc record", nil},
+		{"no html", []byte(image), "no html document in warc", nil},
+		{"empty", nil, "no html document in warc", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ps, err := NewParser(Options{Fetcher: offlineFetcher(t)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = ps.newParser(context.Background()).readWARC(bytes.NewReader(tt.data), nil)
+			if err == nil {
+				t.Fatal("want error")
+			}
+			if tt.is != nil && !errors.Is(err, tt.is) {
+				t.Errorf("err = %v, want %v", err, tt.is)
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestReadWARCKeepImages(t *testing.T) {
+	data := strings.Join([]string{
+		warcResponse("https://mp.weixin.qq.com/s/abc", "200 OK", "text/html", archiveTestPage),
+		warcResponse("https://mmbiz.qpic.cn/mmbiz_png/a/0?wx_fmt=png", "200 OK", "image/png", "image-a"),
+		warcResponse("https://mmbiz.qpic.cn/mmbiz_png/other/0", "200 OK", "image/png", "other"),
+		warcResponse("https://res.wx.qq.com/a.js", "200 OK", "application/javascript", "var a"),
+		warcResponse("https://mmbiz.qpic.cn/mmbiz_png/big/0", "200 OK", "image/png", strings.Repeat("x", 2000)),
+	}, "")
+	images := referencedImages([]byte(archiveTestPage))
+	tests := []struct {
+		name   string
+		keep   func(string) bool
+		limits Limits
+		want   []string
+	}{
+		{
+			name: "all images",
+			want: []string{"mmbiz.qpic.cn/mmbiz_png/a", "mmbiz.qpic.cn/mmbiz_png/big", "mmbiz.qpic.cn/mmbiz_png/other"},
+		},
+		{
+			name: "referenced images only",
+			keep: func(rawURL string) bool { return images[resourceKey(rawURL)] },
+			want: []string{"mmbiz.qpic.cn/mmbiz_png/a"},
+		},
+		{
+			name:   "oversized records skipped",
+			limits: Limits{MaxPageBytes: 1000, MaxImageBytes: 100},
+			want:   []string{"mmbiz.qpic.cn/mmbiz_png/a", "mmbiz.qpic.cn/mmbiz_png/other"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ps, err := NewParser(Options{Fetcher: offlineFetcher(t), Limits: tt.limits})
+			if err != nil {
+				t.Fatal(err)
+			}
+			p := ps.newParser(context.Background())
+			page, err := p.readWARC(strings.NewReader(data), tt.keep)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if page.URL != "https://mp.weixin.qq.com/s/abc" {
+				t.Errorf("page url = %q", page.URL)
+			}
+			var keys []string
+			for key := range p.resources {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			if strings.Join(keys, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("resources = %v, want %v", keys, tt.want)
+			}
+		})
+	}
+}
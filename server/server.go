@@ -1,10 +1,14 @@
 package server
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"mime"
 	"net/http"
 	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/fengxxc/wechatmp2markdown/format"
@@ -12,7 +16,7 @@ import (
 	"github.com/fengxxc/wechatmp2markdown/util"
 )
 
-func Start(addr string) {
+func Start(addr string) error {
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		rawQuery := r.URL.RawQuery
 		paramsMap := parseParams(rawQuery)
@@ -25,43 +29,88 @@ func Start(addr string) {
 		proxy := paramsMap["proxy"]
 		fmt.Printf("     proxy: %s\n", proxy)
 		imagePolicy := parse.ImageArgValue2ImagePolicy(imageArgValue)
+		imageQuality := parse.ImageArgValue2ImageQuality(paramsMap["quality"])
+		headings := parse.HeadingOptions{Detection: parse.HeadingArgValue2HeadingDetection(paramsMap["headings"])}
+		formatOpts := format.Options{
+			FrontMatter: format.FrontMatterArgValue2FrontMatterFormat(paramsMap["frontmatter"]),
+			Flavor:      format.FlavorArgValue2Flavor(paramsMap["flavor"]),
+		}
 
 		if wechatmpURL == "" {
 			w.WriteHeader(http.StatusBadRequest)
 			w.Write([]byte(defHTML))
 			return
 		}
-		w.Header().Set("Content-Type", "application/octet-stream")
-		var articleStruct parse.Article
-		if proxy != "" {
-			// 尝试使用代理
-			defer func() {
-				if r := recover(); r != nil {
-					log.Printf("代理请求失败，尝试不使用代理: %v", r)
-					// 如果代理失败，降级到不使用代理
-					articleStruct = parse.ParseFromURL(wechatmpURL, imagePolicy)
-				}
-			}()
-			articleStruct = parse.ParseFromURLWithProxy(wechatmpURL, imagePolicy, proxy)
-		} else {
-			articleStruct = parse.ParseFromURL(wechatmpURL, imagePolicy)
+		articleStruct, err := parse.Parse(r.Context(), wechatmpURL, parse.Options{ImagePolicy: imagePolicy, ImageQuality: imageQuality, Headings: headings, Proxy: proxy})
+		if proxy != "" && retryWithoutProxy(r.Context(), err) {
+			// 如果代理失败，降级到不使用代理
+			log.Printf("代理请求失败，尝试不使用代理: %v", err)
+			articleStruct, err = parse.Parse(r.Context(), wechatmpURL, parse.Options{ImagePolicy: imagePolicy, ImageQuality: imageQuality, Headings: headings})
+		}
+		if r.Context().Err() != nil {
+			// 客户端已断开，不再返回结果
+			log.Printf("parse article %s canceled: %v", wechatmpURL, r.Context().Err())
+			return
+		}
+		if err != nil {
+			log.Printf("parse article %s error: %v", wechatmpURL, err)
+			writeError(w, err)
+			return
 		}
 		title := articleStruct.Title.Val.(string)
-		mdString, saveImageBytes := format.Format(articleStruct)
-		if len(saveImageBytes) > 0 {
-			w.Header().Set("Content-Disposition", "attachment; filename="+title+".zip")
-			saveImageBytes[title] = []byte(mdString)
-			util.HttpDownloadZip(w, saveImageBytes)
+		if len(articleStruct.FailedImages) > 0 {
+			// 部分图片下载失败，通过响应头告知客户端
+			for _, imgErr := range articleStruct.FailedImages {
+				log.Printf("failed image: %s", imgErr.Error())
+			}
+			w.Header().Set("X-Failed-Images", strconv.Itoa(len(articleStruct.FailedImages)))
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		if imagePolicy == parse.IMAGE_POLICY_SAVE {
+			archiveName, files := format.FormatArchiveFilesWithOptions(articleStruct, formatOpts)
+			w.Header().Set("Content-Disposition", contentDisposition(archiveName+".zip"))
+			util.HttpDownloadZip(w, files)
 		} else {
-			w.Header().Set("Content-Disposition", "attachment; filename="+title+".md")
+			mdString, _ := format.FormatWithOptions(articleStruct, formatOpts)
+			w.Header().Set("Content-Disposition", contentDisposition(title+".md"))
 			w.Write([]byte(mdString))
 		}
 	})
 
 	fmt.Printf("wechatmp2markdown server listening on %s\n", addr)
-	if err := http.ListenAndServe(addr, nil); err != nil {
-		log.Fatal(err)
+	return http.ListenAndServe(addr, nil)
+}
+
+// retryWithoutProxy 只有网络错误（如代理无法连接）时才不使用代理重试；
+// 文章已删除、不是公众号文章、4xx 等与代理无关的错误，以及客户端断开时直接返回
+func retryWithoutProxy(ctx context.Context, err error) bool {
+	if err == nil || ctx.Err() != nil {
+		return false
+	}
+	var netErr *parse.NetworkError
+	return errors.As(err, &netErr)
+}
+
+// contentDisposition 下载文件名可能保存到任意系统上，使用所有系统都合法的文件名；非ASCII字符按 RFC 2231 编码
+func contentDisposition(fileName string) string {
+	fileName = util.SanitizeFilename(fileName, util.PortableOS)
+	return mime.FormatMediaType("attachment", map[string]string{"filename": fileName})
+}
+
+// 将解析错误转换为对应的http状态码返回
+func writeError(w http.ResponseWriter, err error) {
+	var statusErr *parse.HTTPStatusError
+	var netErr *parse.NetworkError
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, parse.ErrArticleDeleted):
+		status = http.StatusGone
+	case errors.Is(err, parse.ErrNotWechatPage):
+		status = http.StatusUnprocessableEntity
+	case errors.As(err, &statusErr), errors.As(err, &netErr):
+		status = http.StatusBadGateway
 	}
+	http.Error(w, err.Error(), status)
 }
 
 var defHTML string = `
@@ -273,6 +322,22 @@ var defHTML string = `
 					<div class="param-name">image 参数（可选）</div>
 					<div class="param-desc">图片保存方式：'url'（引用原地址） / 'save'（保存到本地） / 'base64'（编码到文件内，默认）</div>
 				</div>
+				<div class="param-item">
+					<div class="param-name">quality 参数（可选）</div>
+					<div class="param-desc">图片质量：'original'（保持原图格式和分辨率，默认） / 'compact'（统一转为jpeg，体积更小）</div>
+				</div>
+				<div class="param-item">
+					<div class="param-name">frontmatter 参数（可选）</div>
+					<div class="param-desc">在markdown开头输出标题、作者、发布时间、话题等元数据：'none'（不输出，默认） / 'yaml' / 'toml'</div>
+				</div>
+				<div class="param-item">
+					<div class="param-name">flavor 参数（可选）</div>
+					<div class="param-desc">markdown方言：'extended'（删除线 ~~、高亮 ==，默认） / 'gfm'（高亮 &lt;mark&gt;） / 'commonmark'（删除线 &lt;del&gt;、高亮 &lt;mark&gt;），下划线都为 &lt;u&gt;</div>
+				</div>
+				<div class="param-item">
+					<div class="param-name">headings 参数（可选）</div>
+					<div class="param-desc">正文中的标题：'auto'（还根据字号、粗体、居中和“一、”等编号推断标题，默认） / 'off'（只识别 h1~h6）</div>
+				</div>
 				<div class="param-item">
 					<div class="param-name">proxy 参数（可选）</div>
 					<div class="param-desc">代理服务器地址，格式：'ip:port'，例如：'127.0.0.1:8080'</div>
@@ -344,6 +409,38 @@ func parseParams(rawQuery string) map[string]string {
 		}
 	}
 
+	// 解析 quality 参数
+	regQuality := regexp.MustCompile(`(&?quality=)([a-z]+)`)
+	matcheQuality := regQuality.FindStringSubmatch(remainingQuery)
+	if len(matcheQuality) > 2 {
+		remainingQuery = strings.Replace(remainingQuery, matcheQuality[0], "", 1)
+		result["quality"] = matcheQuality[2]
+	}
+
+	// 解析 frontmatter 参数
+	regFrontMatter := regexp.MustCompile(`(&?frontmatter=)([a-z]+)`)
+	matcheFrontMatter := regFrontMatter.FindStringSubmatch(remainingQuery)
+	if len(matcheFrontMatter) > 2 {
+		remainingQuery = strings.Replace(remainingQuery, matcheFrontMatter[0], "", 1)
+		result["frontmatter"] = matcheFrontMatter[2]
+	}
+
+	// 解析 flavor 参数
+	regFlavor := regexp.MustCompile(`(&?flavor=)([a-z]+)`)
+	matcheFlavor := regFlavor.FindStringSubmatch(remainingQuery)
+	if len(matcheFlavor) > 2 {
+		remainingQuery = strings.Replace(remainingQuery, matcheFlavor[0], "", 1)
+		result["flavor"] = matcheFlavor[2]
+	}
+
+	// 解析 headings 参数
+	regHeadings := regexp.MustCompile(`(&?headings=)([a-z]+)`)
+	matcheHeadings := regHeadings.FindStringSubmatch(remainingQuery)
+	if len(matcheHeadings) > 2 {
+		remainingQuery = strings.Replace(remainingQuery, matcheHeadings[0], "", 1)
+		result["headings"] = matcheHeadings[2]
+	}
+
 	// 解析 url 参数
 	regUrl := regexp.MustCompile(`(&?url=)(.+)`)
 	matcheUrl := regUrl.FindStringSubmatch(remainingQuery)
@@ -0,0 +1,37 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/fengxxc/wechatmp2markdown/parse"
+)
+
+func TestRetryWithoutProxy(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	netErr := &parse.NetworkError{URL: "https://mp.weixin.qq.com/s/a", Err: errors.New("proxyconnect tcp: connection refused")}
+	tests := []struct {
+		name string
+		ctx  context.Context
+		err  error
+		want bool
+	}{
+		{"success", context.Background(), nil, false},
+		{"network error", context.Background(), netErr, true},
+		{"wrapped network error", context.Background(), fmt.Errorf("request error: %w", netErr), true},
+		{"article deleted", context.Background(), parse.ErrArticleDeleted, false},
+		{"not a wechat page", context.Background(), parse.ErrNotWechatPage, false},
+		{"http 404", context.Background(), &parse.HTTPStatusError{StatusCode: http.StatusNotFound}, false},
+		{"client disconnected", canceled, context.Canceled, false},
+		{"network error after disconnect", canceled, netErr, false},
+	}
+	for _, tt := range tests {
+		if got := retryWithoutProxy(tt.ctx, tt.err); got != tt.want {
+			t.Errorf("%s: retryWithoutProxy = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package util
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// WriteFileAtomic 先写同目录下的临时文件再重命名为 name，写到一半时中断不会留下不完整的文件
+func WriteFileAtomic(name string, data []byte, perm os.FileMode) error {
+	tmpName, err := writeTempFile(name, data, perm)
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmpName, name); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	return nil
+}
+
+// link 创建硬链接，测试时替换以模拟不支持硬链接的文件系统
+var link = os.Link
+
+// WriteFileExclusive 同 WriteFileAtomic，但 name 已存在时不覆盖，返回 os.ErrExist
+func WriteFileExclusive(name string, data []byte, perm os.FileMode) error {
+	tmpName, err := writeTempFile(name, data, perm)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpName)
+	// 硬链接在目标已存在时失败，可以避免并发写入同名文件时互相覆盖
+	err = link(tmpName, name)
+	if err == nil || errors.Is(err, os.ErrExist) {
+		return err
+	}
+	// 不支持硬链接的文件系统，退化为先检查再重命名
+	if _, err := os.Lstat(name); err == nil {
+		return &os.PathError{Op: "write", Path: name, Err: os.ErrExist}
+	}
+	return os.Rename(tmpName, name)
+}
+
+// 临时文件名的格式，不包含目标文件名，目标文件名接近 MaxFilenameBytes 时也不会超长
+const tempFilePattern = ".w2m-*.tmp"
+
+func writeTempFile(name string, data []byte, perm os.FileMode) (string, error) {
+	tmp, err := os.CreateTemp(filepath.Dir(name), tempFilePattern)
+	if err != nil {
+		return "", err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return tmp.Name(), nil
+}
@@ -0,0 +1,114 @@
+package util
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// tempFiles dir 中残留的临时文件
+func tempFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	matches, err := filepath.Glob(filepath.Join(dir, tempFilePattern))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return matches
+}
+
+func readFile(t *testing.T, name string) string {
+	t.Helper()
+	content, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "a.md")
+	for _, content := range []string{"first", "second"} {
+		if err := WriteFileAtomic(name, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if got := readFile(t, name); got != content {
+			t.Errorf("content = %q, want %q", got, content)
+		}
+	}
+	if info, err := os.Stat(name); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("mode = %v, %v, want 0600", info.Mode().Perm(), err)
+	}
+
+	// 目标是非空目录时重命名失败，临时文件被删除
+	target := filepath.Join(dir, "dir")
+	if err := os.MkdirAll(filepath.Join(target, "child"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFileAtomic(target, []byte("x"), 0644); err == nil {
+		t.Error("want error when the target is a directory")
+	}
+	if err := WriteFileAtomic(filepath.Join(dir, "missing", "a.md"), []byte("x"), 0644); err == nil {
+		t.Error("want error when the directory does not exist")
+	}
+	if files := tempFiles(t, dir); len(files) != 0 {
+		t.Errorf("temp files left: %v", files)
+	}
+}
+
+func TestWriteFileExclusive(t *testing.T) {
+	tests := []struct {
+		name string
+		link func(oldname, newname string) error
+	}{
+		{"hard link", os.Link},
+		{"link not supported", func(oldname, newname string) error {
+			return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: syscall.EPERM}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func(orig func(string, string) error) { link = orig }(link)
+			link = tt.link
+			dir := t.TempDir()
+			name := filepath.Join(dir, "a.md")
+			if err := WriteFileExclusive(name, []byte("first"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			err := WriteFileExclusive(name, []byte("second"), 0644)
+			if !errors.Is(err, os.ErrExist) {
+				t.Errorf("err = %v, want os.ErrExist", err)
+			}
+			if got := readFile(t, name); got != "first" {
+				t.Errorf("content = %q, existing file was overwritten", got)
+			}
+			if files := tempFiles(t, dir); len(files) != 0 {
+				t.Errorf("temp files left: %v", files)
+			}
+		})
+	}
+}
+
+func TestWriteFileLongName(t *testing.T) {
+	dir := t.TempDir()
+	// 255 字节的文件名，临时文件名不能比它更长
+	name := filepath.Join(dir, strings.Repeat("中", 84)+".md")
+	if len(filepath.Base(name)) != MaxFilenameBytes {
+		t.Fatalf("file name is %d bytes", len(filepath.Base(name)))
+	}
+	if err := WriteFileAtomic(name, []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(name); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFileExclusive(name, []byte("b"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if files := tempFiles(t, dir); len(files) != 0 {
+		t.Errorf("temp files left: %v", files)
+	}
+}
@@ -0,0 +1,109 @@
+package util
+
+import (
+	"path"
+	"runtime"
+	"strings"
+	"unicode/utf8"
+)
+
+// PortableOS 作为 SanitizeFilename 的 goos 参数时，生成在所有系统上都合法的文件名
+const PortableOS = "portable"
+
+// MaxFilenameBytes 文件名的最大字节数，大多数文件系统限制为255字节
+const MaxFilenameBytes = 255
+
+// 非法字符替换为相似的Unicode字符
+var (
+	windowsReplacer = strings.NewReplacer(
+		"<", "≺",
+		">", "≻",
+		":", "∶",
+		"\"", "“",
+		"/", "∕",
+		"\\", "∖",
+		"|", "∣",
+		"?", "？",
+		"*", "⁎",
+	)
+	darwinReplacer = strings.NewReplacer(
+		"/", "∕",
+		":", "∶",
+	)
+	unixReplacer = strings.NewReplacer(
+		"/", "∕",
+	)
+)
+
+// windows的保留文件名，不区分大小写，带扩展名也不行（如 CON.md）
+var windowsReservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// SafeFilename 按当前系统的规则处理文件名
+func SafeFilename(name string) string {
+	return SanitizeFilename(name, runtime.GOOS)
+}
+
+// SanitizeFilename 按 goos 系统的规则处理文件名（不含目录）：
+// 去掉控制字符，非法字符用相似的Unicode字符替换，windows下处理保留文件名及末尾的点和空格，
+// 超过 MaxFilenameBytes 字节时按字符截断并尽量保留扩展名。
+// goos 为 PortableOS 时同时满足windows、macOS和linux的规则
+func SanitizeFilename(name string, goos string) string {
+	if name == "" {
+		return ""
+	}
+	name = strings.ToValidUTF8(name, "")
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return -1
+		}
+		return r
+	}, name)
+
+	windows := goos == "windows" || goos == PortableOS
+	switch {
+	case windows:
+		name = windowsReplacer.Replace(name)
+	case goos == "darwin" || goos == "ios":
+		name = darwinReplacer.Replace(name)
+	default:
+		name = unixReplacer.Replace(name)
+	}
+
+	name = TruncateFilename(name, MaxFilenameBytes)
+	if windows {
+		// windows会去掉末尾的点和空格，导致文件名与预期的不一致
+		name = strings.TrimRight(name, ". ")
+		base := name
+		if i := strings.IndexByte(base, '.'); i >= 0 {
+			base = base[:i]
+		}
+		if windowsReservedNames[strings.ToUpper(strings.TrimSpace(base))] {
+			name = strings.TrimSpace(base) + "_" + name[len(base):]
+		}
+	}
+	if name == "" || name == "." || name == ".." {
+		return "_"
+	}
+	return name
+}
+
+// TruncateFilename 把文件名截断到 max 字节以内，不会截断多字节字符，扩展名较短时保留扩展名
+func TruncateFilename(name string, max int) string {
+	if len(name) <= max {
+		return name
+	}
+	ext := path.Ext(name)
+	if len(ext) > 16 {
+		ext = ""
+	}
+	base := name[:len(name)-len(ext)]
+	limit := max - len(ext)
+	for limit > 0 && !utf8.RuneStart(base[limit]) {
+		limit--
+	}
+	return base[:limit] + ext
+}
@@ -0,0 +1,77 @@
+package util
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTruncateFilename(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		max  int
+		want string
+	}{
+		{"short name kept", "标题.md", 255, "标题.md"},
+		{"ascii keeps extension", "abcdefgh.md", 8, "abcde.md"},
+		{"cjk not cut in the middle", "中文标题.md", 11, "中文.md"},
+		{"cjk exact boundary", "中文标题.md", 12, "中文标.md"},
+		{"long extension dropped", "abc.abcdefghijklmnopqrstuvwxyz", 5, "abc.a"},
+		{"no extension", "中文标题", 7, "中文"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := TruncateFilename(tt.in, tt.max)
+			if got != tt.want {
+				t.Errorf("TruncateFilename(%q, %d) = %q, want %q", tt.in, tt.max, got, tt.want)
+			}
+			if len(got) > tt.max || !utf8.ValidString(got) {
+				t.Errorf("TruncateFilename(%q, %d) = %q is too long or invalid", tt.in, tt.max, got)
+			}
+		})
+	}
+}
+
+func TestSanitizeFilename(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		goos string
+		want string
+	}{
+		{"linux slash", "a/b:c", "linux", "a∕b:c"},
+		{"darwin colon", "a/b:c", "darwin", "a∕b∶c"},
+		{"windows illegal chars", `a<b>c:"d"|e?f*g\h`, "windows", "a≺b≻c∶“d“∣e？f⁎g∖h"},
+		{"control chars removed", "a\tb\x00c\x7f", "linux", "abc"},
+		{"invalid utf8 removed", "a\xffb", "linux", "ab"},
+		{"windows trailing dots and spaces", "title. .", "windows", "title"},
+		{"linux keeps trailing dot", "title.", "linux", "title."},
+		{"reserved name", "CON", "windows", "CON_"},
+		{"reserved name with extension", "con.md", "windows", "con_.md"},
+		{"reserved name with space", "NUL .md", "windows", "NUL_.md"},
+		{"reserved name portable", "LPT1.tar.gz", PortableOS, "LPT1_.tar.gz"},
+		{"reserved name allowed on linux", "CON.md", "linux", "CON.md"},
+		{"not reserved", "CONSOLE.md", "windows", "CONSOLE.md"},
+		{"empty after cleaning", "\x01", "linux", "_"},
+		{"dot dot", "..", "linux", "_"},
+		{"only dots on windows", "...", "windows", "_"},
+		{"empty", "", "linux", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SanitizeFilename(tt.in, tt.goos); got != tt.want {
+				t.Errorf("SanitizeFilename(%q, %q) = %q, want %q", tt.in, tt.goos, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSanitizeFilenameLength(t *testing.T) {
+	for _, goos := range []string{"linux", "darwin", "windows", PortableOS} {
+		got := SanitizeFilename(strings.Repeat("中", 100)+".md", goos)
+		if len(got) > MaxFilenameBytes || !utf8.ValidString(got) || !strings.HasSuffix(got, ".md") {
+			t.Errorf("SanitizeFilename(long, %q) = %q (%d bytes)", goos, got, len(got))
+		}
+	}
+}
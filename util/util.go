@@ -1,15 +1,22 @@
 package util
 
 import (
+	"archive/tar"
 	"archive/zip"
 	"bytes"
+	"compress/gzip"
 	"crypto/md5"
+	"encoding/binary"
 	"encoding/hex"
 	"io"
 	"log"
+	"mime"
 	"net/http"
 	"os"
 	"regexp"
+	"sort"
+	"strings"
+	"time"
 )
 
 func MergeMap(m1 map[string][]byte, m2 map[string][]byte) {
@@ -18,39 +25,88 @@ func MergeMap(m1 map[string][]byte, m2 map[string][]byte) {
 	}
 }
 
-func Zip(zipFileName string, files map[string][]byte) {
-	f, err := os.Create(zipFileName)
-	if err != nil {
-		log.Fatal(err)
-		return
+// Zip 把 files 打包成zip文件，key为包内的文件名
+func Zip(zipFileName string, files map[string][]byte) error {
+	return writeArchiveFile(zipFileName, files, WriteZip)
+}
+
+// TarGz 把 files 打包成tar.gz文件，key为包内的文件名
+func TarGz(tarFileName string, files map[string][]byte) error {
+	return writeArchiveFile(tarFileName, files, WriteTarGz)
+}
+
+func writeArchiveFile(fileName string, files map[string][]byte, write func(io.Writer, map[string][]byte) error) error {
+	var buf bytes.Buffer
+	if err := write(&buf, files); err != nil {
+		return err
+	}
+	return WriteFileAtomic(fileName, buf.Bytes(), 0644)
+}
+
+// 按文件名排序，使打包结果稳定
+func sortedNames(files map[string][]byte) []string {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// archiveEntryName 包内的文件名，逐级处理为所有系统都合法的文件名
+func archiveEntryName(name string) string {
+	segments := strings.Split(name, "/")
+	for i, segment := range segments {
+		segments[i] = SanitizeFilename(segment, PortableOS)
 	}
-	defer f.Close()
+	return strings.Join(segments, "/")
+}
 
-	zipWriter := zip.NewWriter(f)
-	for name, file := range files {
-		zw, err := zipWriter.Create(name)
+// WriteZip 把 files 以zip格式写入 w
+func WriteZip(w io.Writer, files map[string][]byte) error {
+	zipWriter := zip.NewWriter(w)
+	now := time.Now()
+	for _, name := range sortedNames(files) {
+		zw, err := zipWriter.CreateHeader(&zip.FileHeader{Name: archiveEntryName(name), Method: zip.Deflate, Modified: now})
 		if err != nil {
-			log.Fatal(err)
+			return err
 		}
-		if _, err := io.Copy(zw, bytes.NewReader(file)); err != nil {
-			log.Fatal(err)
+		if _, err := io.Copy(zw, bytes.NewReader(files[name])); err != nil {
+			return err
 		}
 	}
-	zipWriter.Close()
+	return zipWriter.Close()
 }
 
-func HttpDownloadZip(w http.ResponseWriter, files map[string][]byte) {
-	zipWriter := zip.NewWriter(w)
-	for name, file := range files {
-		zw, err := zipWriter.Create(name)
-		if err != nil {
-			log.Fatal(err)
+// WriteTarGz 把 files 以tar.gz格式写入 w
+func WriteTarGz(w io.Writer, files map[string][]byte) error {
+	gzipWriter := gzip.NewWriter(w)
+	tarWriter := tar.NewWriter(gzipWriter)
+	now := time.Now()
+	for _, name := range sortedNames(files) {
+		hdr := &tar.Header{
+			Name:    archiveEntryName(name),
+			Mode:    0644,
+			Size:    int64(len(files[name])),
+			ModTime: now,
 		}
-		if _, err := io.Copy(zw, bytes.NewReader(file)); err != nil {
-			log.Fatal(err)
+		if err := tarWriter.WriteHeader(hdr); err != nil {
+			return err
 		}
+		if _, err := tarWriter.Write(files[name]); err != nil {
+			return err
+		}
+	}
+	if err := tarWriter.Close(); err != nil {
+		return err
+	}
+	return gzipWriter.Close()
+}
+
+func HttpDownloadZip(w http.ResponseWriter, files map[string][]byte) {
+	if err := WriteZip(w, files); err != nil {
+		log.Printf("write zip error: %v", err)
 	}
-	zipWriter.Close()
 }
 
 func MD5(content []byte) string {
@@ -70,6 +126,80 @@ func ParseImageExtFromSrc(src string) string {
 	return matches[2]
 }
 
+var imageMIMEExts = map[string]string{
+	"image/jpeg":    "jpeg",
+	"image/png":     "png",
+	"image/gif":     "gif",
+	"image/webp":    "webp",
+	"image/svg+xml": "svg",
+	"image/bmp":     "bmp",
+}
+
+// DetectImageType 识别图片的MIME类型，依次根据文件头、响应的 Content-Type、src 中的 wx_fmt 参数判断，
+// 都无法识别时返回 image/png
+func DetectImageType(content []byte, contentType string, src string) string {
+	switch {
+	case bytes.HasPrefix(content, []byte("\xFF\xD8\xFF")):
+		return "image/jpeg"
+	case bytes.HasPrefix(content, []byte("\x89PNG\r\n\x1a\n")):
+		return "image/png"
+	case bytes.HasPrefix(content, []byte("GIF87a")), bytes.HasPrefix(content, []byte("GIF89a")):
+		return "image/gif"
+	case len(content) >= 12 && bytes.Equal(content[:4], []byte("RIFF")) && bytes.Equal(content[8:12], []byte("WEBP")):
+		return "image/webp"
+	case isBMP(content):
+		return "image/bmp"
+	case isSVG(content):
+		return "image/svg+xml"
+	}
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+		if _, ok := imageMIMEExts[mediaType]; ok {
+			return mediaType
+		}
+	}
+	switch strings.ToLower(ParseImageExtFromSrc(src)) {
+	case "jpg", "jpeg":
+		return "image/jpeg"
+	case "gif":
+		return "image/gif"
+	case "webp":
+		return "image/webp"
+	case "svg":
+		return "image/svg+xml"
+	case "bmp":
+		return "image/bmp"
+	}
+	return "image/png"
+}
+
+// BMP 的 DIB 头长度，分别为 BITMAPCOREHEADER、BITMAPINFOHEADER、V2~V5
+var bmpDIBHeaderSizes = map[uint32]bool{12: true, 40: true, 52: true, 56: true, 64: true, 108: true, 124: true}
+
+// isBMP 以 “BM” 开头的文本很常见，还需要 14 字节的文件头之后是合法的 DIB 头长度
+func isBMP(content []byte) bool {
+	if len(content) < 18 || !bytes.HasPrefix(content, []byte("BM")) {
+		return false
+	}
+	return bmpDIBHeaderSizes[binary.LittleEndian.Uint32(content[14:18])]
+}
+
+func isSVG(content []byte) bool {
+	head := content
+	if len(head) > 1024 {
+		head = head[:1024]
+	}
+	head = bytes.TrimSpace(head)
+	return (bytes.HasPrefix(head, []byte("<?xml")) || bytes.HasPrefix(head, []byte("<svg"))) && bytes.Contains(head, []byte("<svg"))
+}
+
+// ImageExtFromMIME 图片MIME类型对应的文件扩展名（不含“.”）
+func ImageExtFromMIME(mimeType string) string {
+	if ext, ok := imageMIMEExts[mimeType]; ok {
+		return ext
+	}
+	return "png"
+}
+
 // 判断路径是否存在
 func PathIsExists(path string) (os.FileInfo, bool) {
 	f, err := os.Stat(path)
@@ -0,0 +1,70 @@
+package util
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// bmpHeader 14 字节的文件头加上 DIB 头长度
+func bmpHeader(dibSize uint32) string {
+	header := make([]byte, 18)
+	copy(header, "BM")
+	binary.LittleEndian.PutUint32(header[14:], dibSize)
+	return string(header)
+}
+
+func TestDetectImageType(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     string
+		contentType string
+		src         string
+		want        string
+	}{
+		{"jpeg", "\xFF\xD8\xFF\xE0rest", "", "", "image/jpeg"},
+		{"png", "\x89PNG\r\n\x1a\nrest", "image/jpeg", "", "image/png"},
+		{"gif87a", "GIF87a...", "", "", "image/gif"},
+		{"gif89a", "GIF89a...", "", "", "image/gif"},
+		{"webp", "RIFF\x00\x00\x00\x00WEBPVP8 ", "", "", "image/webp"},
+		{"riff without webp", "RIFF\x00\x00\x00\x00WAVEfmt ", "", "", "image/png"},
+		{"bmp info header", bmpHeader(40) + "pixels", "", "", "image/bmp"},
+		{"bmp v5 header", bmpHeader(124), "", "", "image/bmp"},
+		{"bmp core header", bmpHeader(12), "", "", "image/bmp"},
+		{"text starting with BM", "BMW is a car maker", "", "", "image/png"},
+		{"BM with invalid dib size", bmpHeader(1000), "", "", "image/png"},
+		{"short BM", "BM", "", "", "image/png"},
+		{"svg", `<svg xmlns="http://www.w3.org/2000/svg"></svg>`, "", "", "image/svg+xml"},
+		{"svg with xml declaration", "\n<?xml version=\"1.0\"?>\n<svg></svg>", "", "", "image/svg+xml"},
+		{"xml that is not svg", `<?xml version="1.0"?><rss></rss>`, "", "", "image/png"},
+		{"content type", "unknown", "image/gif; charset=binary", "", "image/gif"},
+		{"non-image content type ignored", "unknown", "text/html", "https://mmbiz.qpic.cn/a/640?wx_fmt=jpeg", "image/jpeg"},
+		{"wx_fmt jpg", "unknown", "", "https://mmbiz.qpic.cn/a/640?wx_fmt=jpg&from=appmsg", "image/jpeg"},
+		{"wx_fmt gif", "unknown", "", "https://mmbiz.qpic.cn/a/640?wx_fmt=gif", "image/gif"},
+		{"wx_fmt webp", "unknown", "", "https://mmbiz.qpic.cn/a/640?wx_fmt=webp", "image/webp"},
+		{"wx_fmt svg", "unknown", "", "https://mmbiz.qpic.cn/a/640?wx_fmt=svg", "image/svg+xml"},
+		{"wx_fmt bmp", "unknown", "", "https://mmbiz.qpic.cn/a/640?wx_fmt=bmp", "image/bmp"},
+		{"fallback", "", "", "https://example.com/a", "image/png"},
+	}
+	for _, tt := range tests {
+		if got := DetectImageType([]byte(tt.content), tt.contentType, tt.src); got != tt.want {
+			t.Errorf("%s: DetectImageType = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestImageExtFromMIME(t *testing.T) {
+	tests := []struct {
+		mime string
+		want string
+	}{
+		{"image/jpeg", "jpeg"},
+		{"image/svg+xml", "svg"},
+		{"image/bmp", "bmp"},
+		{"application/octet-stream", "png"},
+	}
+	for _, tt := range tests {
+		if got := ImageExtFromMIME(tt.mime); got != tt.want {
+			t.Errorf("ImageExtFromMIME(%s) = %s, want %s", tt.mime, got, tt.want)
+		}
+	}
+}